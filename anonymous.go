@@ -0,0 +1,50 @@
+package djinn
+
+// The methods shared by *User and AnonymousUser, so handlers and templates
+// can treat the user of a request uniformly, like request.user in Django
+type AuthUser interface {
+	String() string
+	IsAuthenticated() bool
+	IsAnonymous() bool
+	HasPerm(perm string) (bool, error)
+	HasPerms(perms ...string) (bool, error)
+	HasModulePerms(appLabel string) (bool, error)
+	GetAllPermissions() ([]string, error)
+	Groups() ([]*Group, error)
+}
+
+// The user of an unauthenticated request, like Django's AnonymousUser.
+// It has no groups or permissions and is never staff or a superuser.
+type AnonymousUser struct{}
+
+func (a AnonymousUser) String() string {
+	return "AnonymousUser"
+}
+
+func (a AnonymousUser) IsAuthenticated() bool {
+	return false
+}
+
+func (a AnonymousUser) IsAnonymous() bool {
+	return true
+}
+
+func (a AnonymousUser) HasPerm(perm string) (bool, error) {
+	return false, nil
+}
+
+func (a AnonymousUser) HasPerms(perms ...string) (bool, error) {
+	return false, nil
+}
+
+func (a AnonymousUser) HasModulePerms(appLabel string) (bool, error) {
+	return false, nil
+}
+
+func (a AnonymousUser) GetAllPermissions() ([]string, error) {
+	return nil, nil
+}
+
+func (a AnonymousUser) Groups() ([]*Group, error) {
+	return nil, nil
+}
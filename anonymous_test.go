@@ -0,0 +1,78 @@
+package djinn
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestAnonymousUser(t *testing.T) {
+	var user AuthUser = AnonymousUser{}
+	if user.IsAuthenticated() || !user.IsAnonymous() {
+		t.Error("Expected the anonymous user to be anonymous")
+	}
+	ok, err := user.HasPerm("auth.add_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("Unexpected permission for the anonymous user")
+	}
+	groups, err := user.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("Unexpected length of anonymous groups: %d != 0", len(groups))
+	}
+	expectString(t, user.String(), "AnonymousUser")
+
+	// A User implements the same interface
+	user = &User{Username: "client"}
+	if !user.IsAuthenticated() || user.IsAnonymous() {
+		t.Error("Expected the user to be authenticated")
+	}
+
+	// Contexts without a user have an anonymous user
+	user = CurrentUser(context.Background())
+	if !user.IsAnonymous() {
+		t.Error("Expected an anonymous user from an empty context")
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	config.PasswordHasher = "md5"
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	db := createSqliteTestSchema(t, sqliteUserSchema, sqliteSessionSchema)
+	defer db.Close()
+
+	client, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := GetUser(sessionRequest(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsAnonymous() {
+		t.Error("Expected an anonymous user without a session")
+	}
+
+	req := sessionRequest(t, nil)
+	req.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: "missing"})
+	user, err = GetUser(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsAnonymous() {
+		t.Error("Expected an anonymous user with a missing session")
+	}
+
+	user, err = GetUser(sessionRequest(t, client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, user.String(), "client")
+}
@@ -0,0 +1,89 @@
+package djinn
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+// The argon2 hasher of Django. Passwords are hashed with argon2id and
+// encoded like "argon2$argon2id$v=19$m=102400,t=2,p=8$salt$hash", where the
+// salt and hash are unpadded base64. Passwords hashed with argon2i by older
+// versions of Django are also verified. The cost parameters may be changed,
+// which only affects new hashes.
+type Argon2Hasher struct {
+	BaseHasher
+	TimeCost    uint32
+	MemoryCost  uint32 // in KiB
+	Parallelism uint8
+}
+
+func (a *Argon2Hasher) Encode(cleartext, salt string) string {
+	hashed := argon2.IDKey([]byte(cleartext), []byte(salt), a.TimeCost, a.MemoryCost, a.Parallelism, 32)
+	return fmt.Sprintf(
+		"%s$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		a.algorithm,
+		argon2.Version,
+		a.MemoryCost,
+		a.TimeCost,
+		a.Parallelism,
+		base64.RawStdEncoding.EncodeToString([]byte(salt)),
+		base64.RawStdEncoding.EncodeToString(hashed),
+	)
+}
+
+func (a *Argon2Hasher) Verify(cleartext, encoded string) bool {
+	// Split the saved hash apart
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != a.algorithm {
+		return false
+	}
+
+	// Only version 19 of argon2 is supported
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+	if memory == 0 || time == 0 || threads == 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	hashed, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(hashed) == 0 {
+		return false
+	}
+
+	// Re-create the hash with the parameters of the saved hash
+	var rehash []byte
+	switch parts[1] {
+	case "argon2id":
+		rehash = argon2.IDKey([]byte(cleartext), salt, time, memory, threads, uint32(len(hashed)))
+	case "argon2i":
+		rehash = argon2.Key([]byte(cleartext), salt, time, memory, threads, uint32(len(hashed)))
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare(rehash, hashed) == 1
+}
+
+// Create an argon2 hasher with the given time cost, memory cost in KiB and
+// parallelism
+func NewArgon2Hasher(time, memory uint32, threads uint8) *Argon2Hasher {
+	return &Argon2Hasher{BaseHasher{algorithm: "argon2"}, time, memory, threads}
+}
+
+func init() {
+	// The default costs of Django's Argon2PasswordHasher
+	argon2 := NewArgon2Hasher(2, 102400, 8)
+	RegisterHasher(argon2.algorithm, argon2)
+}
@@ -0,0 +1,174 @@
+package djinn
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The authorization checks of django.contrib.auth.backends.ModelBackend.
+// Permissions are "app_label.codename" strings, such as "auth.add_user".
+// Inactive users have no permissions and active superusers have them all.
+
+// Select the "app_label.codename" of permissions with the given conditions
+func selectPermissions(where string, parameters ...interface{}) (map[string]bool, error) {
+	db := Permissions.db
+	query := fmt.Sprintf(
+		`SELECT "django_content_type"."app_label", "auth_permission"."codename" FROM "auth_permission" INNER JOIN "django_content_type" ON "auth_permission"."content_type_id" = "django_content_type"."id"%s`,
+		where,
+	)
+	rows, err := db.Query(query, parameters...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	perms := make(map[string]bool)
+	for rows.Next() {
+		var appLabel, codename string
+		if err = rows.Scan(&appLabel, &codename); err != nil {
+			return nil, err
+		}
+		perms[appLabel+"."+codename] = true
+	}
+	return perms, rows.Err()
+}
+
+// Select the permissions given directly to the user with the given id
+func selectUserPermissions(userId int64) (map[string]bool, error) {
+	where := fmt.Sprintf(
+		` WHERE "auth_permission"."id" IN (SELECT "permission_id" FROM "auth_user_user_permissions" WHERE "user_id" = %s)`,
+		Permissions.db.dialect.Parameter(0),
+	)
+	return selectPermissions(where, userId)
+}
+
+// Select the permissions of the groups of the user with the given id
+func selectGroupPermissions(userId int64) (map[string]bool, error) {
+	where := fmt.Sprintf(
+		` WHERE "auth_permission"."id" IN (SELECT "permission_id" FROM "auth_group_permissions" WHERE "group_id" IN (SELECT "group_id" FROM "auth_user_groups" WHERE "user_id" = %s))`,
+		Permissions.db.dialect.Parameter(0),
+	)
+	return selectPermissions(where, userId)
+}
+
+// Convert a set of permissions to a sorted list
+func sortedPermissions(perms map[string]bool) []string {
+	list := make([]string, 0, len(perms))
+	for perm := range perms {
+		list = append(list, perm)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Get the permissions given directly to the user as sorted
+// "app_label.codename" strings
+func (u *User) GetUserPermissions() ([]string, error) {
+	if !u.IsActive {
+		return nil, nil
+	}
+	if u.IsSuperuser {
+		return u.GetAllPermissions()
+	}
+	perms, err := selectUserPermissions(u.Id)
+	if err != nil {
+		return nil, err
+	}
+	return sortedPermissions(perms), nil
+}
+
+// Get the permissions the user has through its groups as sorted
+// "app_label.codename" strings
+func (u *User) GetGroupPermissions() ([]string, error) {
+	if !u.IsActive {
+		return nil, nil
+	}
+	if u.IsSuperuser {
+		return u.GetAllPermissions()
+	}
+	perms, err := selectGroupPermissions(u.Id)
+	if err != nil {
+		return nil, err
+	}
+	return sortedPermissions(perms), nil
+}
+
+// Get the union of the user and group permissions of the user.
+// The permissions are cached on the user until its permissions or groups
+// are changed.
+func (u *User) allPermissions() (map[string]bool, error) {
+	if !u.IsActive {
+		return map[string]bool{}, nil
+	}
+	if u.permCache != nil {
+		return u.permCache, nil
+	}
+	var perms map[string]bool
+	var err error
+	if u.IsSuperuser {
+		perms, err = selectPermissions("")
+	} else {
+		// The parameter is given twice since postgres parameters are numbered
+		where := fmt.Sprintf(
+			` WHERE "auth_permission"."id" IN (SELECT "permission_id" FROM "auth_user_user_permissions" WHERE "user_id" = %s) OR "auth_permission"."id" IN (SELECT "permission_id" FROM "auth_group_permissions" WHERE "group_id" IN (SELECT "group_id" FROM "auth_user_groups" WHERE "user_id" = %s))`,
+			Permissions.db.dialect.Parameter(0),
+			Permissions.db.dialect.Parameter(1),
+		)
+		perms, err = selectPermissions(where, u.Id, u.Id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.permCache = perms
+	return perms, nil
+}
+
+// Get every permission of the user as sorted "app_label.codename" strings
+func (u *User) GetAllPermissions() ([]string, error) {
+	perms, err := u.allPermissions()
+	if err != nil {
+		return nil, err
+	}
+	return sortedPermissions(perms), nil
+}
+
+// Does the user have the given "app_label.codename" permission?
+// Active superusers have every permission, inactive users have none.
+func (u *User) HasPerm(perm string) (bool, error) {
+	if u.IsActive && u.IsSuperuser {
+		return true, nil
+	}
+	perms, err := u.allPermissions()
+	if err != nil {
+		return false, err
+	}
+	return perms[perm], nil
+}
+
+// Does the user have every one of the given permissions?
+func (u *User) HasPerms(perms ...string) (bool, error) {
+	for _, perm := range perms {
+		ok, err := u.HasPerm(perm)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Does the user have any permission in the given app?
+func (u *User) HasModulePerms(appLabel string) (bool, error) {
+	if u.IsActive && u.IsSuperuser {
+		return true, nil
+	}
+	perms, err := u.allPermissions()
+	if err != nil {
+		return false, err
+	}
+	for perm := range perms {
+		if strings.HasPrefix(perm, appLabel+".") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,133 @@
+package djinn
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"strings"
+	"testing"
+)
+
+func expectPerm(t *testing.T, user *User, perm string, expected bool) {
+	ok, err := user.HasPerm(perm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != expected {
+		t.Errorf("Unexpected HasPerm(%q) for %s: %t != %t", perm, user, ok, expected)
+	}
+}
+
+func TestModelBackend(t *testing.T) {
+	config.PasswordHasher = "md5"
+
+	db := createSqlitePermissionSchema(t)
+	defer db.Close()
+
+	client, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	editors, err := Groups.Create("editors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addUser, err := Permissions.GetByNaturalKey("auth.add_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addGroup, err := Permissions.GetByNaturalKey("auth.add_group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectPerm(t, client, "auth.add_user", false)
+	ok, err := client.HasModulePerms("auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("Unexpected module permissions for auth")
+	}
+
+	// Permissions are the union of user and group permissions
+	if err = client.AddPermission(addUser); err != nil {
+		t.Fatal(err)
+	}
+	if err = editors.AddPermission(addGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.AddGroup(editors); err != nil {
+		t.Fatal(err)
+	}
+	expectPerm(t, client, "auth.add_user", true)
+	expectPerm(t, client, "auth.add_group", true)
+	expectPerm(t, client, "auth.delete_user", false)
+
+	ok, err = client.HasPerms("auth.add_user", "auth.add_group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("Expected the client to have both permissions")
+	}
+	ok, err = client.HasPerms("auth.add_user", "auth.delete_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("Unexpected permissions for the client")
+	}
+
+	perms, err := client.GetAllPermissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, strings.Join(perms, ","), "auth.add_group,auth.add_user")
+
+	perms, err = client.GetUserPermissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, strings.Join(perms, ","), "auth.add_user")
+
+	perms, err = client.GetGroupPermissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, strings.Join(perms, ","), "auth.add_group")
+
+	ok, err = client.HasModulePerms("auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("Expected module permissions for auth")
+	}
+
+	// Changing the groups of the user resets the permission cache
+	if err = client.RemoveGroup(editors); err != nil {
+		t.Fatal(err)
+	}
+	expectPerm(t, client, "auth.add_group", false)
+
+	// Inactive users have no permissions
+	client.IsActive = false
+	expectPerm(t, client, "auth.add_user", false)
+
+	// Active superusers have every permission
+	admin, err := Users.CreateSuperuser("admin", "", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPerm(t, admin, "auth.delete_user", true)
+	expectPerm(t, admin, "nonexistent.perm", true)
+	perms, err = admin.GetAllPermissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(perms) != 4 {
+		t.Errorf("Unexpected length of superuser permissions: %d != 4", len(perms))
+	}
+
+	admin.IsActive = false
+	expectPerm(t, admin, "auth.delete_user", false)
+}
@@ -0,0 +1,162 @@
+package djinn
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/blowfish"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+/*
+The bcrypt hash below is adapted from golang.org/x/crypto/bcrypt, which does
+not export hashing with a given salt.
+
+Copyright (c) 2009 The Go Authors. All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+   * Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+   * Redistributions in binary form must reproduce the above
+copyright notice, this list of conditions and the following disclaimer
+in the documentation and/or other materials provided with the
+distribution.
+   * Neither the name of Google Inc. nor the names of its
+contributors may be used to endorse or promote products derived from
+this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+"AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+var errBcryptSalt = errors.New("djinn: improperly formatted bcrypt salt")
+
+// bcrypt uses its own base64 alphabet without padding
+var bcryptEncoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").WithPadding(base64.NoPadding)
+
+// "OrpheanBeholderScryDoubt"
+var bcryptMagic = []byte{
+	0x4f, 0x72, 0x70, 0x68,
+	0x65, 0x61, 0x6e, 0x42,
+	0x65, 0x68, 0x6f, 0x6c,
+	0x64, 0x65, 0x72, 0x53,
+	0x63, 0x72, 0x79, 0x44,
+	0x6f, 0x75, 0x62, 0x74,
+}
+
+// Hash the password with the given "$2b$12$" prefixed salt, which may be a
+// complete bcrypt hash. Only the first 72 bytes of the password are used.
+func bcryptHash(password []byte, salt string) (string, error) {
+	// The prefix, cost and 22 characters of salt
+	if len(salt) < 29 || salt[0] != '$' || salt[1] != '2' || salt[3] != '$' || salt[6] != '$' {
+		return "", errBcryptSalt
+	}
+	cost, err := strconv.Atoi(salt[4:6])
+	if err != nil || cost < 4 || cost > 31 {
+		return "", errBcryptSalt
+	}
+	csalt, err := bcryptEncoding.DecodeString(salt[7:29])
+	if err != nil {
+		return "", errBcryptSalt
+	}
+
+	// Like C implementations, the trailing NULL is part of the key
+	if len(password) > 72 {
+		password = password[:72]
+	}
+	key := append(password[:len(password):len(password)], 0)
+	c, err := blowfish.NewSaltedCipher(key, csalt)
+	if err != nil {
+		return "", err
+	}
+	for i := uint64(0); i < 1<<uint(cost); i++ {
+		blowfish.ExpandKey(key, c)
+		blowfish.ExpandKey(csalt, c)
+	}
+
+	data := make([]byte, len(bcryptMagic))
+	copy(data, bcryptMagic)
+	for i := 0; i < 24; i += 8 {
+		for j := 0; j < 64; j++ {
+			c.Encrypt(data[i:i+8], data[i:i+8])
+		}
+	}
+	// Like C implementations, only 23 of the 24 encrypted bytes are encoded
+	return salt[:29] + bcryptEncoding.EncodeToString(data[:23]), nil
+}
+
+// The bcrypt hashers of Django. The bcrypt_sha256 hasher hashes the
+// password with sha256 first, so that passwords longer than 72 bytes are
+// not truncated. Encoded passwords have the algorithm prefixed to the bcrypt
+// hash, such as "bcrypt_sha256$$2b$12$...".
+type BCryptHasher struct {
+	BaseHasher
+	rounds int
+	digest func() hash.Hash // nil if the password is used directly
+}
+
+// Create a random salt with the "$2b$" prefix and cost of the hasher
+func (b *BCryptHasher) Salt() string {
+	return fmt.Sprintf("$2b$%02d$%s", b.rounds, bcryptEncoding.EncodeToString(RandomBytes(16)))
+}
+
+// Encode the cleartext with the given salt, returning an empty string if
+// the salt is improperly formatted
+func (b *BCryptHasher) Encode(cleartext, salt string) string {
+	password := []byte(cleartext)
+	if b.digest != nil {
+		h := b.digest()
+		h.Write(password)
+		password = []byte(hex.EncodeToString(h.Sum(nil)))
+	}
+	hashed, err := bcryptHash(password, salt)
+	if err != nil {
+		return ""
+	}
+	return b.algorithm + "$" + hashed
+}
+
+func (b *BCryptHasher) Verify(cleartext, encoded string) bool {
+	parts := strings.SplitN(encoded, "$", 2)
+	if len(parts) != 2 || parts[0] != b.algorithm {
+		return false
+	}
+	rehash := b.Encode(cleartext, parts[1])
+	return rehash != "" && ConstantTimeStringCompare(rehash, encoded)
+}
+
+// Create a bcrypt hasher with the given cost
+func NewBCryptHasher(rounds int) *BCryptHasher {
+	return &BCryptHasher{BaseHasher{algorithm: "bcrypt"}, rounds, nil}
+}
+
+// Create a bcrypt_sha256 hasher with the given cost
+func NewBCryptSHA256Hasher(rounds int) *BCryptHasher {
+	return &BCryptHasher{BaseHasher{algorithm: "bcrypt_sha256"}, rounds, sha256.New}
+}
+
+func init() {
+	// The default cost of Django's bcrypt hashers
+	bcrypt_sha256 := NewBCryptSHA256Hasher(12)
+	RegisterHasher(bcrypt_sha256.algorithm, bcrypt_sha256)
+
+	bcrypt := NewBCryptHasher(12)
+	RegisterHasher(bcrypt.algorithm, bcrypt)
+}
@@ -0,0 +1,103 @@
+package djinn
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// A Cache stores values by key until they expire, like Django's low-level
+// cache API. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get the unexpired value of the given key
+	Get(key string) ([]byte, bool)
+
+	// Set the value of the given key. A timeout of zero or less never
+	// expires.
+	Set(key string, value []byte, timeout time.Duration)
+
+	// Delete the given key if it exists
+	Delete(key string)
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// An in-process Cache that holds at most size values, evicting the least
+// recently used value when it is full
+type LRUCache struct {
+	mutex   sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List       // most recently used first
+	now     func() time.Time // the clock of the expirations
+}
+
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expires.IsZero() && entry.expires.Before(c.now()) {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *LRUCache) Set(key string, value []byte, timeout time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var expires time.Time
+	if timeout > 0 {
+		expires = c.now().Add(timeout)
+	}
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRUCache) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// The number of values in the cache, including any that have expired but
+// have not been evicted
+func (c *LRUCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRUCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry).key)
+}
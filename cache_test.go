@@ -0,0 +1,47 @@
+package djinn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := NewLRUCache(2)
+	cache.Set("a", []byte("1"), 0)
+	cache.Set("b", []byte("2"), 0)
+
+	// Using "a" makes "b" the least recently used
+	value, ok := cache.Get("a")
+	if !ok {
+		t.Fatal("Expected the cache to have the key a")
+	}
+	expectString(t, string(value), "1")
+	cache.Set("c", []byte("3"), 0)
+	expectInt(t, cache.Len(), 2)
+	if _, ok = cache.Get("b"); ok {
+		t.Error("Expected the key b to be evicted")
+	}
+
+	// Setting an existing key replaces its value
+	cache.Set("a", []byte("4"), 0)
+	value, _ = cache.Get("a")
+	expectString(t, string(value), "4")
+
+	cache.Delete("a")
+	if _, ok = cache.Get("a"); ok {
+		t.Error("Expected the key a to be deleted")
+	}
+
+	// Expired values are not returned
+	now := time.Unix(1700000000, 0)
+	cache.now = func() time.Time { return now }
+	cache.Set("d", []byte("5"), time.Minute)
+	now = now.Add(time.Minute)
+	if _, ok = cache.Get("d"); !ok {
+		t.Error("Expected the key d to not be expired")
+	}
+	now = now.Add(time.Second)
+	if _, ok = cache.Get("d"); ok {
+		t.Error("Expected the key d to be expired")
+	}
+}
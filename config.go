@@ -8,16 +8,34 @@ import (
 )
 
 type Config struct {
+	AllowedRedirectHosts  []string      `json:"ALLOWED_REDIRECT_HOSTS"`
 	LoginURL              string        `json:"LOGIN_URL"`
+	LoginRedirectURL      string        `json:"LOGIN_REDIRECT_URL"`
 	PasswordHasher        string        `json:"PASSWORD_HASHER"`
+	RedirectFieldName     string        `json:"REDIRECT_FIELD_NAME"`
 	Secret                string        `json:"SECRET_KEY"`
+	SecretKeyFallbacks    []string      `json:"SECRET_KEY_FALLBACKS"`
 	SessionSalt           string        `json:"SESSION_SALT"`
 	SessionCookieAge      time.Duration `json:"SESSION_COOKIE_AGE"`
 	SessionCookieDomain   string        `json:"SESSION_COOKIE_DOMAIN"`
 	SessionCookieHttpOnly bool          `json:"SESSION_COOKIE_HTTPONLY"`
 	SessionCookieName     string        `json:"SESSION_COOKIE_NAME"`
 	SessionCookiePath     string        `json:"SESSION_COOKIE_PATH"`
+	SessionCookieSameSite string        `json:"SESSION_COOKIE_SAMESITE"`
 	SessionCookieSecure   bool          `json:"SESSION_COOKIE_SECURE"`
+	SessionEncoding       string        `json:"SESSION_ENCODING"`
+	SessionEngine         string        `json:"SESSION_ENGINE"`
+	SessionCacheSize      int           `json:"SESSION_CACHE_SIZE"`
+	SessionFilePath       string        `json:"SESSION_FILE_PATH"`
+
+	// Accept the sessions of Django 1.6, which do not have an auth hash and
+	// so survive a change of password. Off by default.
+	AllowSessionsWithoutAuthHash bool `json:"ALLOW_SESSIONS_WITHOUT_AUTH_HASH"`
+
+	// The HMAC algorithm of the session auth hash, either "sha1" like Django
+	// before 3.1 or "sha256" like Django 3.1+. Both are always verified.
+	SessionAuthHashAlgorithm string `json:"SESSION_AUTH_HASH_ALGORITHM"`
+
 	// TODO Database configuration(s)
 	// TODO Specify multiple password hashing algorithms
 }
@@ -36,7 +54,9 @@ func (c Config) Merge(merge Config) Config {
 
 var config = Config{
 	LoginURL:              "/login",
+	LoginRedirectURL:      "/accounts/profile/",
 	PasswordHasher:        "pbkdf2_sha256",
+	RedirectFieldName:     "next",
 	Secret:                "",
 	SessionSalt:           "django.contrib.sessionsSessionStore",
 	SessionCookieAge:      14 * 24 * time.Hour, // 2 weeks
@@ -44,7 +64,14 @@ var config = Config{
 	SessionCookieHttpOnly: true,
 	SessionCookieName:     "sessionid",
 	SessionCookiePath:     "/",
+	SessionCookieSameSite: "Lax",
 	SessionCookieSecure:   false,
+	SessionEncoding:       LegacyEncoding,
+	SessionEngine:         DatabaseSessions,
+	SessionCacheSize:      10000,
+	SessionFilePath:       "", // the temporary directory
+
+	SessionAuthHashAlgorithm: "sha1",
 }
 
 func SetConfig(c Config) {
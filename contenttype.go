@@ -0,0 +1,131 @@
+package djinn
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+var (
+	ContentTypeDoesNotExist = errors.New("djinn: content type does not exist")
+	MultipleContentTypes    = errors.New("djinn: multiple content types returned")
+)
+
+// django_content_type, which has no "name" column since Django 1.8
+type ContentType struct {
+	Id       int64  `db:"id"`
+	AppLabel string `db:"app_label"`
+	Model    string `db:"model"`
+}
+
+// Like Django's app_labeled_name, such as "auth | user"
+func (ct *ContentType) String() string {
+	return ct.AppLabel + " | " + ct.Model
+}
+
+// The natural key of the content type, such as "auth.user"
+func (ct *ContentType) NaturalKey() string {
+	return ct.AppLabel + "." + ct.Model
+}
+
+type ContentTypeManager struct {
+	*ModelManager
+	mutex   sync.RWMutex
+	source  *sql.DB // the database of the cached content types
+	byId    map[int64]ContentType
+	byModel map[string]ContentType // keyed by natural key
+}
+
+// Content types rarely change, so like Django's ContentTypeManager the
+// manager caches every content type it has queried. The cache is emptied
+// when the database connection changes.
+var ContentTypes = &ContentTypeManager{
+	ModelManager: newModelManager("django_content_type", ContentType{}, ContentTypeDoesNotExist, MultipleContentTypes),
+	byId:         make(map[int64]ContentType),
+	byModel:      make(map[string]ContentType),
+}
+
+func (m *ContentTypeManager) cache(ct *ContentType) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.source != m.db.DB {
+		m.clear()
+		m.source = m.db.DB
+	}
+	m.byId[ct.Id] = *ct
+	m.byModel[ct.NaturalKey()] = *ct
+}
+
+// Get a copy of a cached content type, so callers cannot modify the cache.
+// Content types cached from a previous database connection are ignored.
+func (m *ContentTypeManager) cached(get func() (ContentType, bool)) (*ContentType, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.source != m.db.DB {
+		return nil, false
+	}
+	ct, ok := get()
+	if !ok {
+		return nil, false
+	}
+	return &ct, true
+}
+
+func (m *ContentTypeManager) clear() {
+	m.byId = make(map[int64]ContentType)
+	m.byModel = make(map[string]ContentType)
+}
+
+// Empty the content type cache
+func (m *ContentTypeManager) ClearCache() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.clear()
+}
+
+func (m *ContentTypeManager) All() (contentTypes []*ContentType, err error) {
+	err = m.ModelManager.All(&contentTypes)
+	return
+}
+
+func (m *ContentTypeManager) Get(values Values) (*ContentType, error) {
+	ct := &ContentType{}
+	if err := m.ModelManager.Get(ct, values); err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+// Get the content type with the given id, using the cache if possible
+func (m *ContentTypeManager) GetId(id int64) (*ContentType, error) {
+	if ct, ok := m.cached(func() (ContentType, bool) {
+		ct, ok := m.byId[id]
+		return ct, ok
+	}); ok {
+		return ct, nil
+	}
+	ct, err := m.Get(Values{"id": id})
+	if err != nil {
+		return nil, err
+	}
+	m.cache(ct)
+	return ct, nil
+}
+
+// Get the content type of the given app label and model name, such as
+// ("auth", "user"), using the cache if possible. Unlike Django the content
+// type will not be created if it does not exist.
+func (m *ContentTypeManager) GetForModel(appLabel, model string) (*ContentType, error) {
+	if ct, ok := m.cached(func() (ContentType, bool) {
+		ct, ok := m.byModel[appLabel+"."+model]
+		return ct, ok
+	}); ok {
+		return ct, nil
+	}
+	ct, err := m.Get(Values{"app_label": appLabel, "model": model})
+	if err != nil {
+		return nil, err
+	}
+	m.cache(ct)
+	return ct, nil
+}
@@ -0,0 +1,72 @@
+package djinn
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+)
+
+func TestContentTypes(t *testing.T) {
+	db := createSqlitePermissionSchema(t)
+	defer db.Close()
+
+	ct, err := ContentTypes.GetForModel("auth", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, ct.Id, 3)
+	expectString(t, ct.NaturalKey(), "auth.user")
+	expectString(t, ct.String(), "auth | user")
+
+	_, err = ContentTypes.GetForModel("auth", "sparkles")
+	if err != ContentTypeDoesNotExist {
+		t.Error("Expected a ContentTypeDoesNotExist error, but one did not occur")
+	}
+
+	// Rename the content type behind the manager's back
+	if _, err = db.DB.Exec(`UPDATE "django_content_type" SET "model" = 'renamed' WHERE "id" = 3`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cached content types should be returned by both id and model
+	ct, err = ContentTypes.GetId(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, ct.Model, "user")
+
+	// Callers get copies, which cannot modify the cache
+	ct.Model = "sparkles"
+	ct, err = ContentTypes.GetForModel("auth", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, ct.Model, "user")
+
+	ContentTypes.ClearCache()
+	ct, err = ContentTypes.GetId(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, ct.Model, "renamed")
+
+	// The cache of a previous database connection is not used
+	previous := db.DB
+	db = createSqlitePermissionSchema(t)
+	previous.Close()
+	ct, err = ContentTypes.GetId(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, ct.Model, "user")
+
+	// Permissions resolve their natural key through the content type
+	permission, err := Permissions.GetId(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := permission.NaturalKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, key, "auth.add_group")
+}
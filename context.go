@@ -0,0 +1,97 @@
+package djinn
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey int
+
+const (
+	authKey contextKey = iota
+	sessionStoreKey
+)
+
+// The authentication state of a request
+type authContext struct {
+	user    *User
+	session *Session
+}
+
+// Errors from Authenticate that only mean the request is anonymous
+func isAnonymous(err error) bool {
+	switch err {
+	case http.ErrNoCookie, SessionDoesNotExist, UserDoesNotExist, BadSessionData, InvalidHMAC, BadSignature, InvalidAuthHash:
+		return true
+	}
+	return false
+}
+
+// Attach the given user and session to the context. Either may be nil.
+func withAuth(ctx context.Context, user *User, session *Session) context.Context {
+	return context.WithValue(ctx, authKey, &authContext{user: user, session: session})
+}
+
+// Get the user attached to the request by AuthenticationMiddleware or a
+// wrapper, authenticating the request only if no user has been attached.
+// The returned request has the authentication state in its context.
+func requestUser(req *http.Request) (*User, *http.Request, error) {
+	if auth, ok := req.Context().Value(authKey).(*authContext); ok {
+		return auth.user, req, nil
+	}
+	user, session, err := authenticate(req)
+	if err != nil && !isAnonymous(err) {
+		return nil, req, err
+	}
+	return user, req.WithContext(withAuth(req.Context(), user, session)), nil
+}
+
+// Authenticate every request once and attach the user and session to the
+// request context, where CurrentUser, UserFromContext and SessionFromContext,
+// as well as the LoginRequired and permission wrappers, will find them.
+// Unauthenticated requests are passed on as anonymous, but database errors
+// result in a 500 Internal Server Error.
+func AuthenticationMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, req, err := requestUser(req)
+		if err != nil {
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// Get the authenticated user of the context. The boolean is false if the
+// request is anonymous or was never authenticated.
+func UserFromContext(ctx context.Context) (*User, bool) {
+	auth, ok := ctx.Value(authKey).(*authContext)
+	if !ok || auth.user == nil {
+		return nil, false
+	}
+	return auth.user, true
+}
+
+// Get the user of the context, which is an AnonymousUser if the request is
+// anonymous or was never authenticated
+func CurrentUser(ctx context.Context) AuthUser {
+	if user, ok := UserFromContext(ctx); ok {
+		return user
+	}
+	return AnonymousUser{}
+}
+
+// Get the session of the authenticated user of the context
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	auth, ok := ctx.Value(authKey).(*authContext)
+	if !ok || auth.session == nil {
+		return nil, false
+	}
+	return auth.session, true
+}
+
+// Get the session store attached to the context by SessionMiddleware
+func SessionStoreFromContext(ctx context.Context) (*SessionStore, bool) {
+	store, ok := ctx.Value(sessionStoreKey).(*SessionStore)
+	return store, ok
+}
@@ -8,6 +8,7 @@ import (
 	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
+	"hash"
 	"io"
 	"math/big"
 )
@@ -15,14 +16,20 @@ import (
 // Calculate the HMAC using the salt and secret as the key.
 // The returned byte array will be hex encoded
 func SaltedHMAC(salt, secret, data []byte) []byte {
-	// Calculate the SHA1 digest of the secret + salt
-	h := sha1.New()
+	return saltedHMAC(sha1.New, salt, secret, data)
+}
+
+// Calculate the salted HMAC with the given digest, which Django 3.1+ uses
+// with sha256
+func saltedHMAC(digest func() hash.Hash, salt, secret, data []byte) []byte {
+	// Calculate the digest of the secret + salt
+	h := digest()
 	h.Write(salt)
 	h.Write(secret)
 	key := h.Sum(nil)
 
 	// Create the HMAC
-	hmacd := hmac.New(sha1.New, key)
+	hmacd := hmac.New(digest, key)
 	hmacd.Write(data)
 	b := hmacd.Sum(nil)
 
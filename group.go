@@ -2,12 +2,11 @@ package djinn
 
 import (
 	"errors"
-	"fmt"
 )
 
 var (
 	GroupDoesNotExist = errors.New("djinn: group does not exist")
-	MultipleGroups    = errors.New("djinn: group does not exist")
+	MultipleGroups    = errors.New("djinn: multiple groups returned")
 )
 
 // auth_group
@@ -17,132 +16,89 @@ type Group struct {
 	manager *GroupManager
 }
 
-// TODO Many to many link to permissions
-
 func (group *Group) String() string {
 	return group.Name
 }
 
 func (g *Group) Delete() error {
-	return g.manager.deleteOne(g)
+	return g.manager.Delete(g)
+}
+
+func (g *Group) Save() error {
+	return g.manager.Save(g)
+}
+
+// Get the users of the group ordered by id
+func (g *Group) Users() (users []*User, err error) {
+	err = userGroups.reverse().all(Users.ModelManager, &users, g.Id)
+	return
+}
+
+// Get the permissions of the group ordered by id
+func (g *Group) Permissions() (permissions []*Permission, err error) {
+	err = groupPermissions.all(Permissions.ModelManager, &permissions, g.Id)
+	return
+}
+
+// Give the group the given permissions. Existing permissions are ignored.
+func (g *Group) AddPermission(permissions ...*Permission) error {
+	return groupPermissions.add(g.Id, permissionIds(permissions)...)
+}
+
+// Revoke the given permissions from the group
+func (g *Group) RemovePermission(permissions ...*Permission) error {
+	return groupPermissions.remove(g.Id, permissionIds(permissions)...)
+}
+
+// Set the permissions of the group to exactly the given permissions
+func (g *Group) SetPermissions(permissions ...*Permission) error {
+	return groupPermissions.set(g.Id, permissionIds(permissions)...)
+}
+
+// Revoke every permission of the group
+func (g *Group) ClearPermissions() error {
+	return groupPermissions.clear(g.Id)
 }
 
 type GroupManager struct {
-	*Manager
+	*ModelManager
 }
 
 var Groups = &GroupManager{
-	&Manager{
-		db:      &connection,
-		table:   "auth_group",
-		columns: []string{"id", "name"},
-		primary: "id",
-	},
+	newModelManager("auth_group", Group{}, GroupDoesNotExist, MultipleGroups),
 }
 
-func (m *GroupManager) All() (groups []*Group, err error) {
-	query := fmt.Sprintf(
-		`SELECT %s FROM "%s"`,
-		m.db.JoinColumns(m.columns),
-		m.table,
-	)
-	rows, err := m.db.Query(query)
-	if err != nil {
-		return
-	}
-	for rows.Next() {
-		group := &Group{
-			manager: m,
-		}
-		if err = rows.Scan(&group.Id, &group.Name); err != nil {
-			return
-		}
-		groups = append(groups, group)
+func init() {
+	Groups.prepare = func(obj interface{}) {
+		obj.(*Group).manager = Groups
 	}
-	if err = rows.Err(); err != nil {
-		return
-	}
-	return
 }
 
-func (m *GroupManager) deleteOne(group *Group) error {
-	query := fmt.Sprintf(
-		`DELETE FROM "%s" WHERE "%s" = %s`,
-		m.table,
-		m.primary,
-		m.db.dialect.Parameter(0),
-	)
-	// TODO Save the result of the last operation to the manager?
-	_, err := m.db.Exec(query, group.Id)
-	return err
+func (m *GroupManager) All() (groups []*Group, err error) {
+	err = m.ModelManager.All(&groups)
+	return
 }
 
 func (m *GroupManager) Create(name string) (*Group, error) {
-	group := &Group{
-		Name:    name,
-		manager: m,
-	}
-	// INSERT with an auto-increment id varies between dialects
-	id, err := m.db.dialect.InsertReturningId(m.Manager, []string{"name"}, &group.Name)
-	if err != nil {
+	group := &Group{Name: name}
+	if err := m.ModelManager.Create(group); err != nil {
 		return nil, err
 	}
-	group.Id = id
-	return group, err
+	return group, nil
 }
 
-// Users.Get() behavior (disregarding database or attribute errors):
+// Groups.Get() behavior (disregarding database or attribute errors):
 // * No results:       (nil, GroupDoesNotExist)
-// * One result:       (<user>, nil)
+// * One result:       (<group>, nil)
 // * Multiple results: (nil, MultipleGroups)
 func (m *GroupManager) GetId(id int64) (*Group, error) {
 	return m.Get(Values{"id": id})
 }
 
 func (m *GroupManager) Get(values Values) (*Group, error) {
-	// TODO There must be a database connection and at least one value
-
-	// Build the WHERE statement
-	// These must equal the values given or the function returns an error
-	// TODO Generalize the building of WHERE statements
-	parameters := make([]interface{}, len(values))
-	valid := make([]string, len(values))
-
-	index := 0
-	for key, value := range values {
-		if !m.isValid(key) {
-			return nil, fmt.Errorf(`djinn: invalid column %q in Groups.Get()`, key)
-		}
-		valid[index] = key
-		parameters[index] = value
-		index += 1
-	}
-	query := fmt.Sprintf(
-		`SELECT %s FROM "%s" WHERE %s LIMIT 2`,
-		m.db.JoinColumns(m.columns),
-		m.table,
-		m.db.JoinColumnParametersWith(valid, " AND ", 0),
-	)
-
-	// Destination for queried Group
-	group := &Group{
-		manager: m,
-	}
-
-	rows, err := m.db.Query(query, parameters...)
-	if err != nil {
-		return nil, err
-	}
-
-	// One, and only one result should be returned
-	if !rows.Next() {
-		return nil, GroupDoesNotExist
-	}
-	if err := rows.Scan(&group.Id, &group.Name); err != nil {
+	group := &Group{}
+	if err := m.ModelManager.Get(group, values); err != nil {
 		return nil, err
 	}
-	if rows.Next() {
-		return nil, MultipleGroups
-	}
 	return group, nil
 }
@@ -62,7 +62,164 @@ func TestGroups(t *testing.T) {
 	}
 
 	// Update another
+	groups[1].Name = "updated"
+	if err = groups[1].Save(); err != nil {
+		t.Fatal(err)
+	}
+	group, err = Groups.GetId(groups[1].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, group.Name, "updated")
 
 	// Select with a filter
+	groups = nil
+	if err = Groups.Filter(Values{"name": "updated"}).All(&groups); err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("Unexpected length of filtered groups: %d != 1", len(groups))
+	}
+	expectString(t, groups[0].Name, "updated")
+
+	// Queried groups should be able to delete themselves
+	if err = groups[0].Delete(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Groups.Get(Values{"name": "updated"})
+	if err != GroupDoesNotExist {
+		t.Error("Expected a GroupDoesNotExist error, but one did not occur")
+	}
+
+}
+
+var sqliteUserGroupsSchema = `CREATE TABLE "auth_user_groups" (
+    "id" integer NOT NULL PRIMARY KEY,
+    "user_id" integer NOT NULL,
+    "group_id" integer NOT NULL REFERENCES "auth_group" ("id"),
+    UNIQUE ("user_id", "group_id")
+);`
 
+func TestUserGroups(t *testing.T) {
+	// Set the default hasher to MD5 for fast testing
+	config.PasswordHasher = "md5"
+
+	db := createSqliteTestSchema(t, sqliteUserSchema, sqliteGroupSchema, sqliteUserGroupsSchema)
+	defer db.Close()
+
+	client, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := Users.CreateSuperuser("admin", "", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	editors, err := Groups.Create("editors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewers, err := Groups.Create("viewers")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := client.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("Unexpected length of groups: %d != 0", len(groups))
+	}
+
+	// Adding an existing membership is ignored
+	if err = client.AddGroup(editors, viewers, editors); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.AddGroup(viewers); err != nil {
+		t.Fatal(err)
+	}
+	if err = admin.AddGroup(editors); err != nil {
+		t.Fatal(err)
+	}
+	groups, err = client.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("Unexpected length of groups: %d != 2", len(groups))
+	}
+	expectString(t, groups[0].Name, "editors")
+	expectString(t, groups[1].Name, "viewers")
+
+	users, err := editors.Users()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("Unexpected length of users: %d != 2", len(users))
+	}
+	expectString(t, users[0].Username, "client")
+	expectString(t, users[1].Username, "admin")
+
+	if err = client.RemoveGroup(editors); err != nil {
+		t.Fatal(err)
+	}
+	users, err = editors.Users()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("Unexpected length of users: %d != 1", len(users))
+	}
+
+	if err = admin.SetGroups(viewers); err != nil {
+		t.Fatal(err)
+	}
+	groups, err = admin.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("Unexpected length of groups: %d != 1", len(groups))
+	}
+	expectString(t, groups[0].Name, "viewers")
+
+	if err = client.ClearGroups(); err != nil {
+		t.Fatal(err)
+	}
+	users, err = viewers.Users()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("Unexpected length of users: %d != 1", len(users))
+	}
+	expectString(t, users[0].Username, "admin")
+
+	// Nil and unsaved objects cannot be related
+	for _, group := range []*Group{nil, {Name: "unsaved"}} {
+		if err = admin.AddGroup(group); err != UnsavedObject {
+			t.Error("Expected an UnsavedObject error, but one did not occur")
+		}
+	}
+	if err = (&User{}).SetGroups(editors); err != UnsavedObject {
+		t.Error("Expected an UnsavedObject error, but one did not occur")
+	}
+
+	// A failed set changes nothing
+	if _, err = db.DB.Exec(`CREATE TRIGGER "fail" BEFORE INSERT ON "auth_user_groups" WHEN NEW."group_id" = 404 BEGIN SELECT RAISE(ABORT, 'fail'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if err = admin.SetGroups(editors, &Group{Id: 404}); err == nil {
+		t.Fatal("Expected an error from the trigger, but one did not occur")
+	}
+	groups, err = admin.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("Unexpected length of groups: %d != 1", len(groups))
+	}
+	expectString(t, groups[0].Name, "viewers")
 }
@@ -2,6 +2,7 @@ package djinn
 
 import (
 	"crypto/sha512"
+	"strings"
 	"testing"
 )
 
@@ -50,3 +51,138 @@ func TestHasherRegistry(t *testing.T) {
 	// Nor nil!
 	expectPanic(t, RegisterHasher, "nil", nil)
 }
+
+func TestBCryptHasher(t *testing.T) {
+	// Vectors of the OpenBSD and Openwall implementations
+	vectors := []struct{ password, hash string }{
+		{"U*U", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"},
+		{"U*U*", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.VGOzA784oUp/Z0DY336zx7pLYAy0lwK"},
+		{"U*U*U", "$2a$05$XXXXXXXXXXXXXXXXXXXXXOAcXxm9kjPGEMsLznoKqmqw7tc8WCx4a"},
+		{"", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.7uG0VCzI2bS7j6ymqJi9CdcdxiRTWNy"},
+		{"0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789chars after 72 are ignored", "$2a$05$abcdefghijklmnopqrstuu5s2v8.iXieOjg/.AySBTTZIIVFJeBui"},
+	}
+	for _, vector := range vectors {
+		hashed, err := bcryptHash([]byte(vector.password), vector.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectString(t, hashed, vector.hash)
+	}
+
+	for _, algorithm := range []string{"bcrypt_sha256", "bcrypt"} {
+		hasher, err := GetHasher(algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Use the minimum cost for fast testing
+		salt := "$2b$04$" + hasher.Salt()[7:]
+		hash := hasher.Encode("lètmein", salt)
+		if !strings.HasPrefix(hash, algorithm+"$$2b$04$") {
+			t.Errorf("Unexpected %s hash: %s", algorithm, hash)
+		}
+		if !hasher.Verify("lètmein", hash) {
+			t.Errorf("Could not verify %s password hash", algorithm)
+		}
+		if hasher.Verify("letmein", hash) {
+			t.Errorf("Unexpected verification of an incorrect %s password", algorithm)
+		}
+	}
+
+	// The sha256 hex digest of the password hashed by x/crypto/bcrypt,
+	// which uses the older "$2a$" prefix
+	bcryptSHA256, _ := GetHasher("bcrypt_sha256")
+	if !bcryptSHA256.Verify("lètmein", "bcrypt_sha256$$2a$04$kSKETK5vfg88CpAb7mTEZO/CrWJSU/Wh2h3UFEkCEtlTRcMALso8y") {
+		t.Error("Could not verify a $2a$ bcrypt_sha256 password hash")
+	}
+
+	// Improperly formatted hashes are never verified
+	for _, hash := range []string{"bcrypt$", "bcrypt$$2b$04$short", "bcrypt$$2b$xx$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"} {
+		if bcryptSHA256.Verify("", hash) {
+			t.Errorf("Unexpected verification of %q", hash)
+		}
+	}
+}
+
+func TestArgon2Hasher(t *testing.T) {
+	hasher, err := GetHasher("argon2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Vectors of the argon2 reference implementation
+	vectors := []string{
+		"argon2$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		"argon2$argon2i$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$wWKIMhR9lyDFvRz9YTZweHKfbftvj+qf+YFY4NeBbtA",
+	}
+	for _, vector := range vectors {
+		if !hasher.Verify("password", vector) {
+			t.Errorf("Could not verify argon2 password hash %s", vector)
+		}
+		if hasher.Verify("Password", vector) {
+			t.Errorf("Unexpected verification of an incorrect password for %s", vector)
+		}
+	}
+
+	// Use low costs for fast testing
+	fast := NewArgon2Hasher(1, 64, 1)
+	hash := fast.Encode("lètmein", "seasalt")
+	expectString(t, hash[:strings.LastIndex(hash, "$")], "argon2$argon2id$v=19$m=64,t=1,p=1$c2Vhc2FsdA")
+	if !hasher.Verify("lètmein", hash) {
+		t.Error("Could not verify argon2 password hash")
+	}
+
+	// Improperly formatted or unsupported hashes are never verified
+	for _, hash := range []string{
+		"argon2$",
+		"argon2$argon2d$v=19$m=64,t=1,p=1$c2Vhc2FsdA$aGFzaA",
+		"argon2$argon2id$v=16$m=64,t=1,p=1$c2Vhc2FsdA$aGFzaA",
+		"argon2$argon2id$v=19$m=0,t=1,p=1$c2Vhc2FsdA$aGFzaA",
+		"argon2$argon2id$v=19$m=64,t=1,p=1$c2Vhc2FsdA$",
+		"pbkdf2_sha256$argon2id$v=19$m=64,t=1,p=1$c2Vhc2FsdA$aGFzaA",
+	} {
+		if hasher.Verify("", hash) {
+			t.Errorf("Unexpected verification of %q", hash)
+		}
+	}
+}
+
+func TestScryptHasher(t *testing.T) {
+	hasher, err := GetHasher("scrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hashes made by Django's ScryptPasswordHasher
+	hash := hasher.Encode("lètmein", "seasalt")
+	expectString(t, hash, "scrypt$16384$seasalt$8$1$Qj3+9PPyRjSJIebHnG81TMjsqtaIGxNQG/aEB/NYafTJ7tibgfYz71m0ldQESkXFRkdVCBhhY8mx7rQwite/Pw==")
+	if !hasher.Verify("lètmein", hash) {
+		t.Error("Could not verify scrypt password hash")
+	}
+	if hasher.Verify("letmein", hash) {
+		t.Error("Unexpected verification of an incorrect scrypt password")
+	}
+	if !hasher.Verify("lètmein", "scrypt$16$seasalt$8$2$RHTiiUFUuGVeoqmljIulFWJ0D5PgFj3bOyFSoNtAIZp2C4CnWxtJrxBglGGx5VuAr7KK2kAA5WOWLIQwvJVc6w==") {
+		t.Error("Could not verify scrypt password hash with custom parameters")
+	}
+
+	// Salts cannot contain the separator
+	expectString(t, hasher.Encode("lètmein", "sea$salt"), "")
+
+	// Hashes that need too much memory are neither created nor verified
+	limited := NewScryptHasher(1<<14, 8, 1)
+	limited.MaxMemory = 1024 * 1024
+	expectString(t, limited.Encode("lètmein", "seasalt"), "")
+	if limited.Verify("lètmein", hash) {
+		t.Error("Unexpected verification of a hash over the memory limit")
+	}
+	if hasher.Verify("lètmein", "scrypt$1048576$seasalt$8$1$aGFzaA==") {
+		t.Error("Unexpected verification of a hash over the default memory limit")
+	}
+
+	// Improperly formatted hashes are never verified
+	for _, hash := range []string{"scrypt$", "scrypt$15$seasalt$8$1$aGFzaA==", "scrypt$16$seasalt$0$1$aGFzaA==", "scrypt$x$seasalt$8$1$aGFzaA=="} {
+		if hasher.Verify("", hash) {
+			t.Errorf("Unexpected verification of %q", hash)
+		}
+	}
+}
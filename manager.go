@@ -1,6 +1,16 @@
 package djinn
 
-import ()
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	ObjectDoesNotExist = errors.New("djinn: object does not exist")
+	MultipleObjects    = errors.New("djinn: multiple objects returned")
+)
 
 // A generalized manager instance and base class of schemas specific managers
 type Manager struct {
@@ -20,3 +30,245 @@ func (m *Manager) isValid(column string) bool {
 	}
 	return false
 }
+
+// A ModelManager builds its columns and primary key from the `db` tags of a
+// struct. The primary key defaults to the "id" column and can be set with
+// the "primary" tag option, such as `db:"session_key,primary"`.
+// If the primary key is an integer it is assumed to be auto-incrementing.
+type ModelManager struct {
+	*Manager
+	model        reflect.Type
+	fields       []int // struct field indexes in column order
+	auto         bool
+	doesNotExist error
+	multiple     error
+	prepare      func(interface{}) // called on every queried object
+}
+
+// Create a manager for the given table using the `db` tags of the given
+// struct, which may be a struct value or a pointer to one.
+func NewModelManager(table string, model interface{}) *ModelManager {
+	return newModelManager(table, model, ObjectDoesNotExist, MultipleObjects)
+}
+
+func newModelManager(table string, model interface{}, doesNotExist, multiple error) *ModelManager {
+	t := reflect.TypeOf(model)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		panic("djinn: a ModelManager requires a struct, not " + t.String())
+	}
+	m := &ModelManager{
+		Manager:      &Manager{db: &connection, table: table},
+		model:        t,
+		doesNotExist: doesNotExist,
+		multiple:     multiple,
+	}
+	primaryField := -1
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("db")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		if t.Field(i).PkgPath != "" {
+			panic("djinn: the db tagged field " + t.Field(i).Name + " of " + t.String() + " is unexported")
+		}
+		options := strings.Split(tag, ",")
+		m.columns = append(m.columns, options[0])
+		m.fields = append(m.fields, i)
+		for _, option := range options[1:] {
+			if option == "primary" {
+				m.primary = options[0]
+				primaryField = i
+			}
+		}
+		if m.primary == "" && options[0] == "id" {
+			primaryField = i
+		}
+	}
+	if primaryField == -1 {
+		panic("djinn: no primary key found for " + t.String())
+	}
+	if m.primary == "" {
+		m.primary = "id"
+	}
+	switch t.Field(primaryField).Type.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		m.auto = true
+	}
+	return m
+}
+
+// Get the reflected struct of the given object, which must be a pointer to
+// the manager's model
+func (m *ModelManager) elem(obj interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.Elem().Type() != m.model {
+		return v, fmt.Errorf("djinn: expected a *%s for %s, received %T", m.model, m.table, obj)
+	}
+	return v.Elem(), nil
+}
+
+// Build the destination interfaces of every column
+func (m *ModelManager) dest(elem reflect.Value) []interface{} {
+	dest := make([]interface{}, len(m.fields))
+	for i, field := range m.fields {
+		dest[i] = elem.Field(field).Addr().Interface()
+	}
+	return dest
+}
+
+// Get the field value of the given column
+func (m *ModelManager) field(elem reflect.Value, column string) reflect.Value {
+	for i, col := range m.columns {
+		if col == column {
+			return elem.Field(m.fields[i])
+		}
+	}
+	return reflect.Value{}
+}
+
+// Start a QuerySet of every object
+func (m *ModelManager) Query() *QuerySet {
+	return newQuerySet(m)
+}
+
+// Start a QuerySet of objects that match every given lookup
+func (m *ModelManager) Filter(values Values) *QuerySet {
+	return m.Query().Filter(values)
+}
+
+// Start a QuerySet that excludes objects matching every given lookup
+func (m *ModelManager) Exclude(values Values) *QuerySet {
+	return m.Query().Exclude(values)
+}
+
+// Start a QuerySet of every object in the given order
+func (m *ModelManager) OrderBy(columns ...string) *QuerySet {
+	return m.Query().OrderBy(columns...)
+}
+
+// Get a single object that matches the given values. dest must be a
+// pointer to the manager's model.
+// Behavior (disregarding database or attribute errors):
+// * No results:       DoesNotExist error
+// * One result:       nil
+// * Multiple results: MultipleObjects error
+func (m *ModelManager) Get(dest interface{}, values Values) error {
+	return m.Filter(values).Get(dest)
+}
+
+// Get all objects. dest must be a pointer to a slice of model pointers.
+func (m *ModelManager) All(dest interface{}) error {
+	return m.Query().All(dest)
+}
+
+// Scan every row of the given query into the destination slice
+func (m *ModelManager) selectAll(dest interface{}, query string, parameters ...interface{}) error {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice || slice.Elem().Type().Elem() != reflect.PtrTo(m.model) {
+		return fmt.Errorf("djinn: expected a *[]*%s for %s, received %T", m.model, m.table, dest)
+	}
+	slice = slice.Elem()
+
+	rows, err := m.db.Query(query, parameters...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		obj := reflect.New(m.model)
+		if err = rows.Scan(m.dest(obj.Elem())...); err != nil {
+			return err
+		}
+		if m.prepare != nil {
+			m.prepare(obj.Interface())
+		}
+		slice.Set(reflect.Append(slice, obj))
+	}
+	return rows.Err()
+}
+
+// Insert the given object. If the primary key is auto-incrementing it will
+// be set to the id assigned by the database.
+func (m *ModelManager) Create(obj interface{}) error {
+	elem, err := m.elem(obj)
+	if err != nil {
+		return err
+	}
+	if !m.auto {
+		query := fmt.Sprintf(
+			`INSERT INTO "%s" (%s) VALUES (%s)`,
+			m.table,
+			m.db.JoinColumns(m.columns),
+			m.db.BuildParameters(m.columns),
+		)
+		if _, err = m.db.Exec(query, m.dest(elem)...); err != nil {
+			return err
+		}
+	} else {
+		columns, parameters := m.withoutPrimary(elem)
+
+		// INSERT with an auto-increment id varies between dialects
+		id, err := m.db.dialect.InsertReturningId(m.Manager, columns, parameters...)
+		if err != nil {
+			return err
+		}
+		m.field(elem, m.primary).SetInt(id)
+	}
+	if m.prepare != nil {
+		m.prepare(obj)
+	}
+	return nil
+}
+
+// Update every column of the given object
+// TODO Only update the properties that changed?
+func (m *ModelManager) Save(obj interface{}) error {
+	elem, err := m.elem(obj)
+	if err != nil {
+		return err
+	}
+	columns, parameters := m.withoutPrimary(elem)
+	query := fmt.Sprintf(
+		`UPDATE "%s" SET %s WHERE "%s" = %s`,
+		m.table,
+		m.db.JoinColumnParameters(columns),
+		m.primary,
+		m.db.dialect.Parameter(len(columns)),
+	)
+	parameters = append(parameters, m.field(elem, m.primary).Interface())
+	_, err = m.db.Exec(query, parameters...)
+	return err
+}
+
+// Delete the given object by its primary key
+func (m *ModelManager) Delete(obj interface{}) error {
+	elem, err := m.elem(obj)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(
+		`DELETE FROM "%s" WHERE "%s" = %s`,
+		m.table,
+		m.primary,
+		m.db.dialect.Parameter(0),
+	)
+	_, err = m.db.Exec(query, m.field(elem, m.primary).Interface())
+	return err
+}
+
+// Build the columns and parameters of every column except the primary key
+func (m *ModelManager) withoutPrimary(elem reflect.Value) ([]string, []interface{}) {
+	columns := make([]string, 0, len(m.columns))
+	parameters := make([]interface{}, 0, len(m.columns))
+	for i, column := range m.columns {
+		if column == m.primary {
+			continue
+		}
+		columns = append(columns, column)
+		parameters = append(parameters, elem.Field(m.fields[i]).Addr().Interface())
+	}
+	return columns, parameters
+}
@@ -0,0 +1,131 @@
+package djinn
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+)
+
+var sqliteSiteSchema = `CREATE TABLE "django_site" (
+    "id" integer NOT NULL PRIMARY KEY,
+    "domain" varchar(100) NOT NULL,
+    "name" varchar(50) NOT NULL
+);`
+
+// django_site
+type site struct {
+	Id     int64  `db:"id"`
+	Domain string `db:"domain"`
+	Name   string `db:"name"`
+	ignore string
+}
+
+// A model with a non auto-incrementing primary key
+type option struct {
+	Key   string `db:"key,primary"`
+	Value string `db:"value"`
+}
+
+var sqliteOptionSchema = `CREATE TABLE "option" (
+    "key" varchar(40) NOT NULL PRIMARY KEY,
+    "value" text NOT NULL
+);`
+
+func TestNewModelManager(t *testing.T) {
+	sites := NewModelManager("django_site", site{})
+	expectString(t, sites.primary, "id")
+	if len(sites.columns) != 3 {
+		t.Fatalf("Unexpected length of columns: %d != 3", len(sites.columns))
+	}
+	expectString(t, sites.columns[1], "domain")
+	if !sites.auto {
+		t.Error("Expected an auto-incrementing primary key")
+	}
+
+	options := NewModelManager("option", &option{})
+	expectString(t, options.primary, "key")
+	if options.auto {
+		t.Error("Unexpected auto-incrementing primary key")
+	}
+
+	// Tagged fields must be exported
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for an unexported db field, but one did not occur")
+		}
+	}()
+	NewModelManager("unexported", struct {
+		Id   int64  `db:"id"`
+		name string `db:"name"`
+	}{})
+}
+
+func TestModelManager(t *testing.T) {
+	db := createSqliteTestSchema(t, sqliteSiteSchema, sqliteOptionSchema)
+	defer db.Close()
+
+	sites := NewModelManager("django_site", site{})
+
+	example := &site{Domain: "example.com", Name: "example"}
+	if err := sites.Create(example); err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, example.Id, 1)
+	if err := sites.Create(&site{Domain: "example.org", Name: "org"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only pointers to the model should be accepted
+	if err := sites.Create(site{}); err == nil {
+		t.Error("Expected an error when creating a non-pointer, but one did not occur")
+	}
+
+	var s site
+	if err := sites.Get(&s, Values{"domain": "example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, s.Id, 1)
+	expectString(t, s.Name, "example")
+
+	if err := sites.Get(&s, Values{"domain": "example.net"}); err != ObjectDoesNotExist {
+		t.Error("Expected an ObjectDoesNotExist error, but one did not occur")
+	}
+	if err := sites.Get(&s, nil); err != MultipleObjects {
+		t.Error("Expected a MultipleObjects error, but one did not occur")
+	}
+
+	s.Name = "updated"
+	if err := sites.Save(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	var all []*site
+	if err := sites.All(&all); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("Unexpected length of sites: %d != 2", len(all))
+	}
+	expectString(t, all[0].Name, "updated")
+
+	if err := sites.Delete(all[0]); err != nil {
+		t.Fatal(err)
+	}
+	var filtered []*site
+	if err := sites.Filter(Values{"name": "updated"}).All(&filtered); err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) != 0 {
+		t.Errorf("Unexpected length of filtered sites: %d != 0", len(filtered))
+	}
+
+	// Primary keys that are not auto-incrementing are inserted as given
+	options := NewModelManager("option", option{})
+	if err := options.Create(&option{Key: "theme", Value: "dark"}); err != nil {
+		t.Fatal(err)
+	}
+	var o option
+	if err := options.Get(&o, Values{"key": "theme"}); err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, o.Value, "dark")
+}
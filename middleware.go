@@ -0,0 +1,154 @@
+package djinn
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// The session cookie with the given value and the cookie settings of the
+// config
+func newSessionCookie(value string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     config.SessionCookieName,
+		Value:    value,
+		Path:     config.SessionCookiePath,
+		Domain:   config.SessionCookieDomain,
+		HttpOnly: config.SessionCookieHttpOnly,
+		Secure:   config.SessionCookieSecure,
+	}
+	switch config.SessionCookieSameSite {
+	case "Lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "Strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "None":
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
+
+// Set the session cookie with the given key and expiration
+func setSessionCookie(w http.ResponseWriter, key string, expires time.Time) {
+	cookie := newSessionCookie(key)
+	cookie.Expires = expires
+	cookie.MaxAge = int(config.SessionCookieAge.Seconds())
+	http.SetCookie(w, cookie)
+}
+
+// Expire the session cookie. Like Django's delete_cookie it has the same
+// attributes as the cookie it deletes, which browsers may require.
+func deleteSessionCookie(w http.ResponseWriter) {
+	cookie := newSessionCookie("")
+	cookie.Expires = time.Unix(0, 0)
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+}
+
+// Wraps the http.ResponseWriter to save the session and set its cookie
+// before the headers are written
+type sessionWriter struct {
+	http.ResponseWriter
+	store     *SessionStore
+	hadCookie bool
+	written   bool
+	status    int
+}
+
+func (w *sessionWriter) WriteHeader(status int) {
+	if !w.written {
+		w.written = true
+		w.status = status
+		w.processSession(status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(200)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sessionWriter) Flush() {
+	if !w.written {
+		w.WriteHeader(200)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack the connection of the wrapped http.ResponseWriter, such as for a
+// websocket. The session cookie can no longer be set, but a modified session
+// with a key is still saved.
+func (w *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("djinn: the http.ResponseWriter does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.written = true
+	}
+	return conn, rw, err
+}
+
+// The wrapped http.ResponseWriter, for http.ResponseController
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Like Django's SessionMiddleware.process_response: delete the cookie of a
+// session that was emptied, or save a modified session and set its cookie.
+// Sessions are not saved for 500 responses.
+func (w *sessionWriter) processSession(status int) {
+	if w.store.IsEmpty() {
+		if w.hadCookie {
+			deleteSessionCookie(w)
+		}
+		return
+	}
+	if w.store.Accessed {
+		w.Header().Add("Vary", "Cookie")
+	}
+	if !w.store.Modified || status >= 500 {
+		return
+	}
+	if err := w.store.Save(); err != nil {
+		log.Println("djinn: could not save the session:", err)
+		return
+	}
+	setSessionCookie(w, w.store.Key(), w.store.Expires())
+}
+
+// Load the session of the session cookie on first use and attach it to the
+// request context, where SessionStoreFromContext will find it. Modified
+// sessions are saved and their cookie set when the headers are written.
+// Changes to a new session made after the headers are written are lost,
+// since its cookie can no longer be set.
+func SessionMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var key string
+		if cookie, err := req.Cookie(config.SessionCookieName); err == nil {
+			key = cookie.Value
+		}
+		store := NewSessionStore(key)
+		sw := &sessionWriter{ResponseWriter: w, store: store, hadCookie: key != ""}
+		ctx := context.WithValue(req.Context(), sessionStoreKey, store)
+		h.ServeHTTP(sw, req.WithContext(ctx))
+
+		if !sw.written {
+			sw.processSession(200)
+		} else if store.Modified && store.key != "" && sw.status < 500 {
+			if err := store.Save(); err != nil {
+				log.Println("djinn: could not save the session:", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package djinn
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionMiddleware(t *testing.T) {
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	db := createSqliteTestSchema(t, sqliteSessionSchema)
+	defer db.Close()
+
+	var visits string
+	h := SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok := SessionStoreFromContext(r.Context())
+		if !ok {
+			t.Fatal("Expected a session store in the request context")
+		}
+		switch r.URL.Path {
+		case "/visit":
+			count, _ := session.GetString("visits")
+			session.Set("visits", count+"x")
+			visits = count + "x"
+		case "/clear":
+			session.Clear()
+		case "/logout":
+			if err := session.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		w.Write([]byte(`200`))
+	}))
+
+	serve := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	sessionCookie := func(w *httptest.ResponseRecorder) *http.Cookie {
+		for _, cookie := range (&http.Response{Header: w.Header()}).Cookies() {
+			if cookie.Name == config.SessionCookieName {
+				return cookie
+			}
+		}
+		return nil
+	}
+
+	// Untouched anonymous sessions are not saved
+	w := serve("/", nil)
+	if sessionCookie(w) != nil {
+		t.Error("Unexpected session cookie for an unmodified session")
+	}
+
+	// Modified sessions are saved and their cookie is set
+	w = serve("/visit", nil)
+	cookie := sessionCookie(w)
+	if cookie == nil {
+		t.Fatal("Expected a session cookie for a modified session")
+	}
+	expectInt(t, cookie.MaxAge, int(config.SessionCookieAge.Seconds()))
+	expectString(t, w.Header().Get("Vary"), "Cookie")
+
+	w = serve("/visit", cookie)
+	expectString(t, visits, "xx")
+	expectString(t, sessionCookie(w).Value, cookie.Value)
+
+	// Reading the session does not save it
+	w = serve("/", cookie)
+	if sessionCookie(w) != nil {
+		t.Error("Unexpected session cookie for an unmodified session")
+	}
+
+	// Clearing keeps the key but saves the empty data
+	serve("/clear", cookie)
+	serve("/visit", cookie)
+	expectString(t, visits, "x")
+
+	// Emptied sessions have their cookie deleted with the same attributes
+	config.SessionCookieSecure = true
+	w = serve("/logout", cookie)
+	config.SessionCookieSecure = false
+	deleted := sessionCookie(w)
+	if deleted == nil || deleted.MaxAge >= 0 {
+		t.Fatal("Expected the session cookie to be deleted")
+	}
+	if !deleted.Secure || !deleted.HttpOnly || deleted.SameSite != http.SameSiteLaxMode {
+		t.Error("Expected the deleted session cookie to be Secure, HttpOnly and SameSite=Lax")
+	}
+
+	// Unknown keys are replaced with a new session
+	w = serve("/visit", &http.Cookie{Name: config.SessionCookieName, Value: "unknown"})
+	if c := sessionCookie(w); c == nil || c.Value == "unknown" {
+		t.Error("Expected a new session key for an unknown session")
+	}
+}
+
+// A recorder that can be hijacked
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (r *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.hijacked = true
+	conn, _ := net.Pipe()
+	return conn, bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), nil
+}
+
+func TestSessionMiddleware_Hijack(t *testing.T) {
+	for _, useController := range []bool{false, true} {
+		h := SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var err error
+			if useController {
+				_, _, err = http.NewResponseController(w).Hijack()
+			} else if hijacker, ok := w.(http.Hijacker); ok {
+				_, _, err = hijacker.Hijack()
+			} else {
+				t.Fatal("Expected the session writer to be an http.Hijacker")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}))
+		req, err := http.NewRequest("GET", "/ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+		h.ServeHTTP(w, req)
+		if !w.hijacked {
+			t.Error("Expected the connection to be hijacked")
+		}
+	}
+
+	// Writers that cannot be hijacked return an error
+	h := SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			t.Error("Expected an error hijacking a recorder, but one did not occur")
+		}
+	}))
+	req, err := http.NewRequest("GET", "/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -1,6 +1,15 @@
 package djinn
 
-import ()
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	PermissionDoesNotExist = errors.New("djinn: permission does not exist")
+	MultiplePermissions    = errors.New("djinn: multiple permissions returned")
+)
 
 // auth_permission
 type Permission struct {
@@ -8,8 +17,131 @@ type Permission struct {
 	Name          string `db:"name"`
 	ContentTypeId int64  `db:"content_type_id"`
 	Codename      string `db:"codename"`
+	manager       *PermissionManager
 }
 
 func (p *Permission) String() string {
 	return p.Name
 }
+
+// Get the content type of the permission from the content type cache
+func (p *Permission) ContentType() (*ContentType, error) {
+	return ContentTypes.GetId(p.ContentTypeId)
+}
+
+// The natural key of the permission, such as "auth.add_user"
+func (p *Permission) NaturalKey() (string, error) {
+	ct, err := p.ContentType()
+	if err != nil {
+		return "", err
+	}
+	return ct.AppLabel + "." + p.Codename, nil
+}
+
+func (p *Permission) Delete() error {
+	return p.manager.Delete(p)
+}
+
+func (p *Permission) Save() error {
+	return p.manager.Save(p)
+}
+
+// auth_group_permissions
+var groupPermissions = &manyToMany{
+	db:    &connection,
+	table: "auth_group_permissions",
+	from:  "group_id",
+	to:    "permission_id",
+}
+
+// auth_user_user_permissions
+var userPermissions = &manyToMany{
+	db:    &connection,
+	table: "auth_user_user_permissions",
+	from:  "user_id",
+	to:    "permission_id",
+}
+
+func permissionIds(permissions []*Permission) []int64 {
+	ids := make([]int64, len(permissions))
+	for i, permission := range permissions {
+		if permission != nil {
+			ids[i] = permission.Id
+		}
+	}
+	return ids
+}
+
+type PermissionManager struct {
+	*ModelManager
+}
+
+var Permissions = &PermissionManager{
+	newModelManager("auth_permission", Permission{}, PermissionDoesNotExist, MultiplePermissions),
+}
+
+func init() {
+	Permissions.prepare = func(obj interface{}) {
+		obj.(*Permission).manager = Permissions
+	}
+}
+
+func (m *PermissionManager) All() (permissions []*Permission, err error) {
+	err = m.ModelManager.All(&permissions)
+	return
+}
+
+func (m *PermissionManager) Create(name string, contentTypeId int64, codename string) (*Permission, error) {
+	permission := &Permission{
+		Name:          name,
+		ContentTypeId: contentTypeId,
+		Codename:      codename,
+	}
+	if err := m.ModelManager.Create(permission); err != nil {
+		return nil, err
+	}
+	return permission, nil
+}
+
+// Permissions.Get() behavior (disregarding database or attribute errors):
+// * No results:       (nil, PermissionDoesNotExist)
+// * One result:       (<permission>, nil)
+// * Multiple results: (nil, MultiplePermissions)
+func (m *PermissionManager) GetId(id int64) (*Permission, error) {
+	return m.Get(Values{"id": id})
+}
+
+func (m *PermissionManager) Get(values Values) (*Permission, error) {
+	permission := &Permission{}
+	if err := m.ModelManager.Get(permission, values); err != nil {
+		return nil, err
+	}
+	return permission, nil
+}
+
+// Get a permission by its "app_label.codename" natural key, such as
+// "auth.add_user". The app label is resolved through django_content_type.
+func (m *PermissionManager) GetByNaturalKey(key string) (*Permission, error) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf(`djinn: permission %q is not of the form "app_label.codename"`, key)
+	}
+	query := fmt.Sprintf(
+		`SELECT %s FROM "%s" WHERE "codename" = %s AND "content_type_id" IN (SELECT "id" FROM "django_content_type" WHERE "app_label" = %s) LIMIT 2`,
+		m.db.JoinColumns(m.columns),
+		m.table,
+		m.db.dialect.Parameter(0),
+		m.db.dialect.Parameter(1),
+	)
+	var permissions []*Permission
+	if err := m.selectAll(&permissions, query, parts[1], parts[0]); err != nil {
+		return nil, err
+	}
+	switch len(permissions) {
+	case 0:
+		return nil, PermissionDoesNotExist
+	case 1:
+		return permissions[0], nil
+	}
+	return nil, MultiplePermissions
+}
@@ -0,0 +1,173 @@
+package djinn
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+)
+
+var sqliteContentTypeSchema = `CREATE TABLE "django_content_type" (
+    "id" integer NOT NULL PRIMARY KEY,
+    "app_label" varchar(100) NOT NULL,
+    "model" varchar(100) NOT NULL,
+    UNIQUE ("app_label", "model")
+);`
+
+var sqlitePermissionSchema = `CREATE TABLE "auth_permission" (
+    "id" integer NOT NULL PRIMARY KEY,
+    "name" varchar(50) NOT NULL,
+    "content_type_id" integer NOT NULL REFERENCES "django_content_type" ("id"),
+    "codename" varchar(100) NOT NULL,
+    UNIQUE ("content_type_id", "codename")
+);
+CREATE TABLE "auth_group_permissions" (
+    "id" integer NOT NULL PRIMARY KEY,
+    "group_id" integer NOT NULL,
+    "permission_id" integer NOT NULL REFERENCES "auth_permission" ("id"),
+    UNIQUE ("group_id", "permission_id")
+);
+CREATE TABLE "auth_user_user_permissions" (
+    "id" integer NOT NULL PRIMARY KEY,
+    "user_id" integer NOT NULL,
+    "permission_id" integer NOT NULL REFERENCES "auth_permission" ("id"),
+    UNIQUE ("user_id", "permission_id")
+);`
+
+// The content types and permissions of django.contrib.auth
+var sqlitePermissionData = `INSERT INTO "django_content_type" ("id", "app_label", "model") VALUES
+    (1, 'auth', 'permission'),
+    (2, 'auth', 'group'),
+    (3, 'auth', 'user');
+INSERT INTO "auth_permission" ("id", "name", "content_type_id", "codename") VALUES
+    (1, 'Can add user', 3, 'add_user'),
+    (2, 'Can change user', 3, 'change_user'),
+    (3, 'Can delete user', 3, 'delete_user'),
+    (4, 'Can add group', 2, 'add_group');`
+
+func createSqlitePermissionSchema(t *testing.T) *DB {
+	return createSqliteTestSchema(
+		t,
+		sqliteUserSchema,
+		sqliteGroupSchema,
+		sqliteUserGroupsSchema,
+		sqliteContentTypeSchema,
+		sqlitePermissionSchema,
+		sqlitePermissionData,
+	)
+}
+
+func TestPermissions(t *testing.T) {
+	db := createSqlitePermissionSchema(t)
+	defer db.Close()
+
+	permission, err := Permissions.GetByNaturalKey("auth.change_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, permission.Id, 2)
+	expectString(t, permission.Name, "Can change user")
+
+	_, err = Permissions.GetByNaturalKey("sites.change_user")
+	if err != PermissionDoesNotExist {
+		t.Error("Expected a PermissionDoesNotExist error, but one did not occur")
+	}
+	if _, err = Permissions.GetByNaturalKey("change_user"); err == nil {
+		t.Error("Expected an error from a malformed natural key, but one did not occur")
+	}
+
+	created, err := Permissions.Create("Can view user", 3, "view_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, created.Id, 5)
+
+	permission, err = Permissions.Get(Values{"codename": "view_user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, permission.Id, 5)
+
+	var permissions []*Permission
+	if err = Permissions.Filter(Values{"content_type_id": 3}).All(&permissions); err != nil {
+		t.Fatal(err)
+	}
+	if len(permissions) != 4 {
+		t.Errorf("Unexpected length of permissions: %d != 4", len(permissions))
+	}
+}
+
+func TestPermissionRelations(t *testing.T) {
+	config.PasswordHasher = "md5"
+
+	db := createSqlitePermissionSchema(t)
+	defer db.Close()
+
+	client, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	editors, err := Groups.Create("editors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := Permissions.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = editors.AddPermission(all[0], all[1], all[0]); err != nil {
+		t.Fatal(err)
+	}
+	permissions, err := editors.Permissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(permissions) != 2 {
+		t.Fatalf("Unexpected length of group permissions: %d != 2", len(permissions))
+	}
+	expectString(t, permissions[1].Codename, "change_user")
+
+	if err = editors.SetPermissions(all[2]); err != nil {
+		t.Fatal(err)
+	}
+	permissions, err = editors.Permissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(permissions) != 1 {
+		t.Fatalf("Unexpected length of group permissions: %d != 1", len(permissions))
+	}
+	expectString(t, permissions[0].Codename, "delete_user")
+
+	if err = client.AddPermission(all[3]); err != nil {
+		t.Fatal(err)
+	}
+	permissions, err = client.UserPermissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(permissions) != 1 {
+		t.Fatalf("Unexpected length of user permissions: %d != 1", len(permissions))
+	}
+	expectString(t, permissions[0].Codename, "add_group")
+
+	if err = client.RemovePermission(all[3]); err != nil {
+		t.Fatal(err)
+	}
+	if err = editors.ClearPermissions(); err != nil {
+		t.Fatal(err)
+	}
+	permissions, err = client.UserPermissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(permissions) != 0 {
+		t.Errorf("Unexpected length of user permissions: %d != 0", len(permissions))
+	}
+	permissions, err = editors.Permissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(permissions) != 0 {
+		t.Errorf("Unexpected length of group permissions: %d != 0", len(permissions))
+	}
+}
@@ -0,0 +1,367 @@
+package djinn
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var DeleteWithLimit = errors.New("djinn: cannot delete with a limit or offset")
+
+// The lookups that may follow a column name in Filter and Exclude values,
+// such as "username__iexact". A column without a lookup is an exact match.
+var lookups = map[string]bool{
+	"exact":       true,
+	"iexact":      true,
+	"contains":    true,
+	"icontains":   true,
+	"startswith":  true,
+	"istartswith": true,
+	"endswith":    true,
+	"iendswith":   true,
+	"in":          true,
+	"gt":          true,
+	"gte":         true,
+	"lt":          true,
+	"lte":         true,
+	"isnull":      true,
+}
+
+var comparisons = map[string]string{
+	"exact": "=",
+	"gt":    ">",
+	"gte":   ">=",
+	"lt":    "<",
+	"lte":   "<=",
+}
+
+// A single column lookup, such as "is_staff__exact"
+type condition struct {
+	column string
+	lookup string
+	value  interface{}
+}
+
+// A group of conditions joined with AND, negated when built by Exclude
+type clause struct {
+	conditions []condition
+	negate     bool
+}
+
+// A QuerySet is a lazily evaluated SELECT of a manager's model.
+// Every chained method returns a new QuerySet and leaves the receiver as is.
+// Errors, such as invalid columns, are returned when the QuerySet is
+// evaluated by All, Get, Count, Exists or Delete.
+type QuerySet struct {
+	manager *ModelManager
+	clauses []clause
+	order   []string
+	limit   int // negative for no limit
+	offset  int
+	err     error
+}
+
+func newQuerySet(m *ModelManager) *QuerySet {
+	return &QuerySet{manager: m, limit: -1}
+}
+
+func (q *QuerySet) clone() *QuerySet {
+	c := *q
+	c.clauses = append([]clause{}, q.clauses...)
+	c.order = append([]string{}, q.order...)
+	return &c
+}
+
+func (q *QuerySet) filter(values Values, negate bool) *QuerySet {
+	c := q.clone()
+	if c.err != nil || len(values) == 0 {
+		return c
+	}
+
+	// Sort the keys so the same values always build the same query
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	group := clause{negate: negate}
+	for _, key := range keys {
+		column, lookup := key, "exact"
+		if i := strings.LastIndex(key, "__"); i != -1 && lookups[key[i+2:]] {
+			column, lookup = key[:i], key[i+2:]
+		}
+		if !q.manager.isValid(column) {
+			c.err = fmt.Errorf(`djinn: invalid column %q for %s`, column, q.manager.table)
+			return c
+		}
+		group.conditions = append(group.conditions, condition{column, lookup, values[key]})
+	}
+	c.clauses = append(c.clauses, group)
+	return c
+}
+
+// Only include rows that match every given lookup
+func (q *QuerySet) Filter(values Values) *QuerySet {
+	return q.filter(values, false)
+}
+
+// Exclude rows that match every given lookup
+func (q *QuerySet) Exclude(values Values) *QuerySet {
+	return q.filter(values, true)
+}
+
+// Order the rows by the given columns. Prefix a column with "-" for
+// descending order. Each call replaces any previous ordering.
+func (q *QuerySet) OrderBy(columns ...string) *QuerySet {
+	c := q.clone()
+	c.order = nil
+	for _, column := range columns {
+		direction := "ASC"
+		if strings.HasPrefix(column, "-") {
+			column, direction = column[1:], "DESC"
+		}
+		if !q.manager.isValid(column) {
+			c.err = fmt.Errorf(`djinn: invalid order column %q for %s`, column, q.manager.table)
+			return c
+		}
+		c.order = append(c.order, fmt.Sprintf(`"%s" %s`, column, direction))
+	}
+	return c
+}
+
+// Return at most n rows
+func (q *QuerySet) Limit(n int) *QuerySet {
+	c := q.clone()
+	c.limit = n
+	return c
+}
+
+// Skip the first n rows
+func (q *QuerySet) Offset(n int) *QuerySet {
+	c := q.clone()
+	c.offset = n
+	return c
+}
+
+// Escape the LIKE wildcards of the given value
+func escapeLike(value interface{}) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(fmt.Sprint(value))
+}
+
+// Build the SQL of a single condition, with parameters starting at the
+// given index
+func (q *QuerySet) buildCondition(c condition, start int) (string, []interface{}, error) {
+	dialect := q.manager.db.dialect
+	column := fmt.Sprintf(`"%s"`, c.column)
+	param := dialect.Parameter(start)
+
+	switch c.lookup {
+	case "exact", "gt", "gte", "lt", "lte":
+		if c.value == nil && c.lookup == "exact" {
+			return column + " IS NULL", nil, nil
+		}
+		return fmt.Sprintf(`%s %s %s`, column, comparisons[c.lookup], param), []interface{}{c.value}, nil
+	case "iexact":
+		return fmt.Sprintf(`UPPER(%s) = UPPER(%s)`, column, param), []interface{}{c.value}, nil
+	case "contains", "startswith", "endswith", "icontains", "istartswith", "iendswith":
+		pattern := escapeLike(c.value)
+		lookup := strings.TrimPrefix(c.lookup, "i")
+		if lookup != "startswith" {
+			pattern = "%" + pattern
+		}
+		if lookup != "endswith" {
+			pattern = pattern + "%"
+		}
+		if c.lookup[0] == 'i' {
+			return fmt.Sprintf(`UPPER(%s) LIKE UPPER(%s) ESCAPE '\'`, column, param), []interface{}{pattern}, nil
+		}
+		return fmt.Sprintf(`%s LIKE %s ESCAPE '\'`, column, param), []interface{}{pattern}, nil
+	case "in":
+		v := reflect.ValueOf(c.value)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return "", nil, fmt.Errorf(`djinn: the "in" lookup of %q requires a slice, received %T`, c.column, c.value)
+		}
+		// An empty IN matches nothing
+		if v.Len() == 0 {
+			return "1 = 0", nil, nil
+		}
+		params := make([]string, v.Len())
+		args := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			params[i] = dialect.Parameter(start + i)
+			args[i] = v.Index(i).Interface()
+		}
+		return fmt.Sprintf(`%s IN (%s)`, column, strings.Join(params, ", ")), args, nil
+	case "isnull":
+		isnull, ok := c.value.(bool)
+		if !ok {
+			return "", nil, fmt.Errorf(`djinn: the "isnull" lookup of %q requires a bool, received %T`, c.column, c.value)
+		}
+		if isnull {
+			return column + " IS NULL", nil, nil
+		}
+		return column + " IS NOT NULL", nil, nil
+	}
+	return "", nil, fmt.Errorf(`djinn: unknown lookup %q`, c.lookup)
+}
+
+// Build the WHERE statement and its parameters
+func (q *QuerySet) where() (string, []interface{}, error) {
+	if len(q.clauses) == 0 {
+		return "", nil, nil
+	}
+	var parameters []interface{}
+	groups := make([]string, len(q.clauses))
+	for i, group := range q.clauses {
+		conditions := make([]string, len(group.conditions))
+		for j, c := range group.conditions {
+			sql, params, err := q.buildCondition(c, len(parameters))
+			if err != nil {
+				return "", nil, err
+			}
+			conditions[j] = sql
+			parameters = append(parameters, params...)
+		}
+		groups[i] = strings.Join(conditions, " AND ")
+		if group.negate {
+			groups[i] = fmt.Sprintf(`NOT (%s)`, groups[i])
+		} else if len(q.clauses) > 1 {
+			groups[i] = fmt.Sprintf(`(%s)`, groups[i])
+		}
+	}
+	return " WHERE " + strings.Join(groups, " AND "), parameters, nil
+}
+
+// Build the SELECT statement of the given columns
+func (q *QuerySet) query(columns string) (string, []interface{}, error) {
+	if q.err != nil {
+		return "", nil, q.err
+	}
+	where, parameters, err := q.where()
+	if err != nil {
+		return "", nil, err
+	}
+	query := fmt.Sprintf(`SELECT %s FROM "%s"%s`, columns, q.manager.table, where)
+	if len(q.order) > 0 {
+		query += " ORDER BY " + strings.Join(q.order, ", ")
+	}
+	query += q.manager.db.Limit(q.limit, q.offset)
+	return query, parameters, nil
+}
+
+// Get every matching row. dest must be a pointer to a slice of model
+// pointers.
+func (q *QuerySet) All(dest interface{}) error {
+	query, parameters, err := q.query(q.manager.db.JoinColumns(q.manager.columns))
+	if err != nil {
+		return err
+	}
+	return q.manager.selectAll(dest, query, parameters...)
+}
+
+// Get the single matching row. dest must be a pointer to the manager's
+// model.
+// Behavior (disregarding database or attribute errors):
+// * No results:       DoesNotExist error
+// * One result:       nil
+// * Multiple results: MultipleObjects error
+func (q *QuerySet) Get(dest interface{}) error {
+	m := q.manager
+	elem, err := m.elem(dest)
+	if err != nil {
+		return err
+	}
+	// Only two rows are needed to know there are multiple results
+	if q.limit < 0 || q.limit > 2 {
+		q = q.Limit(2)
+	}
+	query, parameters, err := q.query(m.db.JoinColumns(m.columns))
+	if err != nil {
+		return err
+	}
+	rows, err := m.db.Query(query, parameters...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// One, and only one result should be returned
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return m.doesNotExist
+	}
+	if err = rows.Scan(m.dest(elem)...); err != nil {
+		return err
+	}
+	if rows.Next() {
+		return m.multiple
+	}
+	if m.prepare != nil {
+		m.prepare(dest)
+	}
+	return nil
+}
+
+// Count the matching rows
+func (q *QuerySet) Count() (count int64, err error) {
+	var query string
+	var parameters []interface{}
+	if q.limit < 0 && q.offset == 0 {
+		query, parameters, err = q.query(`COUNT(*)`)
+	} else {
+		// A limited count must be performed on a subquery
+		query, parameters, err = q.query(q.manager.db.JoinColumns([]string{q.manager.primary}))
+		query = fmt.Sprintf(`SELECT COUNT(*) FROM (%s) AS "subquery"`, query)
+	}
+	if err != nil {
+		return
+	}
+	err = q.manager.db.QueryRow(query, parameters...).Scan(&count)
+	return
+}
+
+// Determine if any rows match
+func (q *QuerySet) Exists() (bool, error) {
+	// Only one row is needed, but a smaller limit must be kept
+	if q.limit < 0 || q.limit > 1 {
+		q = q.Limit(1)
+	}
+	query, parameters, err := q.query(`1`)
+	if err != nil {
+		return false, err
+	}
+	rows, err := q.manager.db.Query(query, parameters...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	exists := rows.Next()
+	return exists, rows.Err()
+}
+
+// Delete every matching row. Ordering is ignored. Like Django, a QuerySet
+// with a limit or offset cannot be deleted.
+// Returns the number of rows deleted.
+func (q *QuerySet) Delete() (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	if q.limit >= 0 || q.offset > 0 {
+		return 0, DeleteWithLimit
+	}
+	where, parameters, err := q.where()
+	if err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf(`DELETE FROM "%s"%s`, q.manager.table, where)
+	result, err := q.manager.db.Exec(query, parameters...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
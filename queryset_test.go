@@ -0,0 +1,157 @@
+package djinn
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+)
+
+func expectUsernames(t *testing.T, users []*User, usernames ...string) {
+	if len(users) != len(usernames) {
+		t.Errorf("Unexpected length of users: %d != %d", len(users), len(usernames))
+		return
+	}
+	for i, user := range users {
+		expectString(t, user.Username, usernames[i])
+	}
+}
+
+func TestQuerySet(t *testing.T) {
+	// Set the default hasher to MD5 for fast testing
+	config.PasswordHasher = "md5"
+
+	db := createSqliteTestSchema(t, sqliteUserSchema)
+	defer db.Close()
+
+	for _, name := range []string{"alice", "bob", "carol", "dave", "eve_1"} {
+		if _, err := Users.CreateUser(name, name+"@example.com", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Users.CreateStaff("Admin", "admin@example.com", "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	var users []*User
+	err := Users.Filter(Values{"username__iexact": "ADMIN"}).All(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectUsernames(t, users, "Admin")
+
+	// Queried users should have a manager
+	if err = users[0].Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	users = nil
+	err = Users.Filter(Values{"username__in": []string{"bob", "dave", "zed"}}).OrderBy("-username").All(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectUsernames(t, users, "dave", "bob")
+
+	// Wildcards in contains lookups are escaped
+	users = nil
+	if err = Users.Filter(Values{"username__contains": "_"}).All(&users); err != nil {
+		t.Fatal(err)
+	}
+	expectUsernames(t, users, "eve_1")
+
+	users = nil
+	err = Users.Exclude(Values{"is_staff": true}).Filter(Values{"id__gt": 1, "id__lte": 4}).OrderBy("id").All(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectUsernames(t, users, "bob", "carol", "dave")
+
+	// Page through the users
+	users = nil
+	if err = Users.OrderBy("id").Limit(2).Offset(2).All(&users); err != nil {
+		t.Fatal(err)
+	}
+	expectUsernames(t, users, "carol", "dave")
+
+	users = nil
+	if err = Users.OrderBy("id").Offset(4).All(&users); err != nil {
+		t.Fatal(err)
+	}
+	expectUsernames(t, users, "eve_1", "Admin")
+
+	// An empty IN matches nothing
+	users = nil
+	if err = Users.Filter(Values{"id__in": []int64{}}).All(&users); err != nil {
+		t.Fatal(err)
+	}
+	expectUsernames(t, users)
+
+	count, err := Users.Filter(Values{"email__endswith": "@example.com"}).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, count, 6)
+
+	count, err = Users.Query().Limit(3).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, count, 3)
+
+	exists, err := Users.Filter(Values{"username__istartswith": "AL"}).Exists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Error("Expected a user starting with al to exist")
+	}
+	exists, err = Users.Filter(Values{"email__isnull": true}).Exists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("Unexpected user with a null email")
+	}
+
+	// An empty slice has no rows, like Django's qs[:0].exists()
+	exists, err = Users.Query().Limit(0).Exists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("Unexpected row with a limit of zero")
+	}
+
+	var user User
+	if err = Users.Filter(Values{"username__startswith": "c"}).Get(&user); err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, user.Username, "carol")
+	if err = Users.Filter(Values{"is_staff": false}).Get(&user); err != MultipleUsers {
+		t.Error("Expected a MultipleUsers error, but one did not occur")
+	}
+
+	// Invalid columns are reported on evaluation
+	if _, err = Users.Filter(Values{"sparkles__gt": 1}).Count(); err == nil {
+		t.Error("Expected an error from an invalid column, but one did not occur")
+	}
+	if _, err = Users.OrderBy("sparkles").Exists(); err == nil {
+		t.Error("Expected an error from an invalid order, but one did not occur")
+	}
+
+	// Limited deletes are not allowed and delete nothing
+	for _, qs := range []*QuerySet{Users.OrderBy("id").Limit(1), Users.Query().Offset(1)} {
+		if _, err = qs.Delete(); err != DeleteWithLimit {
+			t.Error("Expected a DeleteWithLimit error, but one did not occur")
+		}
+	}
+	count, err = Users.Query().Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, count, 6)
+
+	deleted, err := Users.Filter(Values{"username__in": []string{"alice", "bob"}}).Delete()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, deleted, 2)
+}
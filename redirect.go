@@ -0,0 +1,115 @@
+package djinn
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Redirect to the login URL with the requested URL in the configured
+// redirect field, like Django's redirect_to_login. The requested URL is
+// given as a path unless the login URL is on another host.
+func RedirectToLogin(w http.ResponseWriter, req *http.Request) {
+	login, err := url.Parse(config.LoginURL)
+	if err != nil || config.RedirectFieldName == "" {
+		http.Redirect(w, req, config.LoginURL, 302)
+		return
+	}
+	next := req.URL.RequestURI()
+	if login.Host != "" && login.Host != req.Host {
+		scheme := "http"
+		if req.TLS != nil {
+			scheme = "https"
+		}
+		next = scheme + "://" + req.Host + next
+	}
+	query := login.Query()
+	query.Set(config.RedirectFieldName, next)
+	login.RawQuery = query.Encode()
+	http.Redirect(w, req, login.String(), 302)
+}
+
+// Get the URL to redirect to after a successful Login: the value of the
+// configured redirect field if it is a safe redirect, otherwise the login
+// redirect URL. Safe URLs are relative or on the request host or one of
+// the allowed redirect hosts, and must be https if the request was.
+func SafeRedirectURL(req *http.Request) string {
+	if config.RedirectFieldName != "" {
+		next := req.FormValue(config.RedirectFieldName)
+		hosts := append([]string{req.Host}, config.AllowedRedirectHosts...)
+		if IsSafeRedirect(next, hosts, req.TLS != nil) {
+			return next
+		}
+	}
+	return config.LoginRedirectURL
+}
+
+// Determine if the given URL is safe to redirect to, which means it is
+// relative or has one of the given hosts and an http(s) scheme. It is a port
+// of Django's url_has_allowed_host_and_scheme.
+func IsSafeRedirect(redirect string, allowedHosts []string, requireHTTPS bool) bool {
+	redirect = strings.TrimSpace(redirect)
+	if redirect == "" {
+		return false
+	}
+	// Browsers treat \ as /, but it could be part of basic auth credentials,
+	// so check both
+	return isSafeRedirect(redirect, allowedHosts, requireHTTPS) &&
+		isSafeRedirect(strings.Replace(redirect, `\`, `/`, -1), allowedHosts, requireHTTPS)
+}
+
+func isSafeRedirect(redirect string, allowedHosts []string, requireHTTPS bool) bool {
+	// Browsers consider any URL with more than two slashes to be absolute
+	if strings.HasPrefix(redirect, "///") {
+		return false
+	}
+	u, err := url.Parse(redirect)
+	if err != nil {
+		return false
+	}
+	host := u.Host
+	if u.User != nil {
+		host = u.User.String() + "@" + host
+	}
+
+	// Forbid URLs with a scheme but without a host, such as
+	// http:///example.com, which browsers treat as having a host
+	if host == "" && u.Scheme != "" {
+		return false
+	}
+
+	// Forbid URLs that start with control characters, which some browsers
+	// ignore and then treat the URL as scheme relative
+	if r, _ := utf8.DecodeRuneInString(redirect); unicode.In(r, unicode.C) {
+		return false
+	}
+
+	// URLs without a scheme, such as //example.com/p, are http
+	scheme := u.Scheme
+	if scheme == "" && host != "" {
+		scheme = "http"
+	}
+	if host != "" {
+		allowed := false
+		for _, h := range allowedHosts {
+			if host == h {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	switch scheme {
+	case "":
+		return true
+	case "https":
+		return true
+	case "http":
+		return !requireHTTPS
+	}
+	return false
+}
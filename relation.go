@@ -0,0 +1,214 @@
+package djinn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Relations can only be made between saved objects
+var UnsavedObject = errors.New("djinn: the related object is nil or has not been saved")
+
+// A many-to-many relation through a join table, such as auth_user_groups.
+// The from column references the owner of the relation and the to column
+// the related objects.
+type manyToMany struct {
+	db    *DB
+	table string
+	from  string
+	to    string
+}
+
+// The same join table viewed from the related side
+func (r *manyToMany) reverse() *manyToMany {
+	return &manyToMany{db: r.db, table: r.table, from: r.to, to: r.from}
+}
+
+// Build a comma separated list of parameters starting at the given index
+func (r *manyToMany) parameters(start, n int) string {
+	parameters := make([]string, n)
+	for i := range parameters {
+		parameters[i] = r.db.dialect.Parameter(start + i)
+	}
+	return strings.Join(parameters, ", ")
+}
+
+// The subquery of related ids
+func (r *manyToMany) subquery() string {
+	return fmt.Sprintf(
+		`SELECT "%s" FROM "%s" WHERE "%s" = %s`,
+		r.to,
+		r.table,
+		r.from,
+		r.db.dialect.Parameter(0),
+	)
+}
+
+// Get the ids related to the given id
+func (r *manyToMany) ids(q querier, from int64) (ids []int64, err error) {
+	rows, err := q.Query(r.subquery(), from)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	err = rows.Err()
+	return
+}
+
+// Select every related object of the target manager into dest, which must
+// be a pointer to a slice of model pointers
+func (r *manyToMany) all(target *ModelManager, dest interface{}, from int64) error {
+	query := fmt.Sprintf(
+		`SELECT %s FROM "%s" WHERE "%s" IN (%s) ORDER BY "%s"`,
+		target.db.JoinColumns(target.columns),
+		target.table,
+		target.primary,
+		r.subquery(),
+		target.primary,
+	)
+	return target.selectAll(dest, query, from)
+}
+
+// Zero ids are of nil or unsaved objects
+func saved(from int64, to ...int64) error {
+	if from == 0 {
+		return UnsavedObject
+	}
+	for _, id := range to {
+		if id == 0 {
+			return UnsavedObject
+		}
+	}
+	return nil
+}
+
+// Run the given function in a transaction, which is committed if it
+// succeeds and rolled back otherwise
+func (r *manyToMany) atomic(f func(tx *transaction) error) error {
+	tx, err := r.db.begin()
+	if err != nil {
+		return err
+	}
+	if err = f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Relate the given ids, ignoring those that are already related
+func (r *manyToMany) add(from int64, to ...int64) error {
+	if err := saved(from, to...); err != nil {
+		return err
+	}
+	return r.atomic(func(tx *transaction) error {
+		return r.insert(tx, from, to...)
+	})
+}
+
+func (r *manyToMany) insert(q querier, from int64, to ...int64) error {
+	existing, err := r.ids(q, from)
+	if err != nil {
+		return err
+	}
+	related := make(map[int64]bool)
+	for _, id := range existing {
+		related[id] = true
+	}
+	query := fmt.Sprintf(
+		`INSERT INTO "%s" ("%s", "%s") VALUES (%s)`,
+		r.table,
+		r.from,
+		r.to,
+		r.parameters(0, 2),
+	)
+	for _, id := range to {
+		if related[id] {
+			continue
+		}
+		if _, err = q.Exec(query, from, id); err != nil {
+			return err
+		}
+		related[id] = true
+	}
+	return nil
+}
+
+// Remove the relations to the given ids
+func (r *manyToMany) remove(from int64, to ...int64) error {
+	if err := saved(from, to...); err != nil {
+		return err
+	}
+	return r.delete(r.db, from, to...)
+}
+
+func (r *manyToMany) delete(q querier, from int64, to ...int64) error {
+	if len(to) == 0 {
+		return nil
+	}
+	query := fmt.Sprintf(
+		`DELETE FROM "%s" WHERE "%s" = %s AND "%s" IN (%s)`,
+		r.table,
+		r.from,
+		r.db.dialect.Parameter(0),
+		r.to,
+		r.parameters(1, len(to)),
+	)
+	parameters := make([]interface{}, len(to)+1)
+	parameters[0] = from
+	for i, id := range to {
+		parameters[i+1] = id
+	}
+	_, err := q.Exec(query, parameters...)
+	return err
+}
+
+// Remove every relation of the given id
+func (r *manyToMany) clear(from int64) error {
+	if err := saved(from); err != nil {
+		return err
+	}
+	query := fmt.Sprintf(
+		`DELETE FROM "%s" WHERE "%s" = %s`,
+		r.table,
+		r.from,
+		r.db.dialect.Parameter(0),
+	)
+	_, err := r.db.Exec(query, from)
+	return err
+}
+
+// Replace the relations of the given id with exactly the given ids. Either
+// every change is made or, on error, none are.
+func (r *manyToMany) set(from int64, to ...int64) error {
+	if err := saved(from, to...); err != nil {
+		return err
+	}
+	return r.atomic(func(tx *transaction) error {
+		existing, err := r.ids(tx, from)
+		if err != nil {
+			return err
+		}
+		keep := make(map[int64]bool)
+		for _, id := range to {
+			keep[id] = true
+		}
+		var removed []int64
+		for _, id := range existing {
+			if !keep[id] {
+				removed = append(removed, id)
+			}
+		}
+		if err = r.delete(tx, from, removed...); err != nil {
+			return err
+		}
+		return r.insert(tx, from, to...)
+	})
+}
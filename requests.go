@@ -2,7 +2,9 @@ package djinn
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 )
 
 var IncorrectPassword = errors.New("djinn: the password was incorrect")
@@ -11,50 +13,75 @@ var IncorrectPassword = errors.New("djinn: the password was incorrect")
 // Returns the User if valid or nil otherwise.
 // TODO What to do about possible database and decoding errors?
 func Authenticate(req *http.Request) (*User, error) {
+	user, _, err := authenticate(req)
+	return user, err
+}
+
+// Read the http.Request object and return the authenticated User or an
+// AnonymousUser, like Django's get_user. The user attached to the request
+// context is used if there is one. Only database errors are returned.
+func GetUser(req *http.Request) (AuthUser, error) {
+	user, _, err := requestUser(req)
+	if err != nil {
+		return AnonymousUser{}, err
+	}
+	if user == nil {
+		return AnonymousUser{}, nil
+	}
+	return user, nil
+}
+
+// Authenticate the request and return both the user and its session
+func authenticate(req *http.Request) (*User, *Session, error) {
 	// Get the session cookie
 	sessionCookie, err := req.Cookie(config.SessionCookieName)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Get the session associated with this key
 	session, err := Sessions.Get(sessionCookie.Value)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Decode the session data using the salt and secret from config
-	sessionData, err := DecodeSessionData(
-		[]byte(config.SessionSalt),
-		[]byte(config.Secret),
-		session.Data,
-	)
+	// Decode the session data using the encoding and secret from config
+	sessionData, err := session.SessionData()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Get the User with the associated Id
-	return Users.GetId(sessionData.AuthUserId)
+	user, err := Users.GetId(sessionData.AuthUserId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Sessions are only valid for the password they were created with.
+	// Sessions of a changed password or without a hash are deleted, like
+	// Django's session flush. Django 1.6 sessions, which do not have a hash,
+	// are only accepted if AllowSessionsWithoutAuthHash is set.
+	if sessionData.AuthUserHash == "" && config.AllowSessionsWithoutAuthHash {
+		return user, session, nil
+	}
+	if !user.verifySessionAuthHash(sessionData.AuthUserHash) {
+		if err = session.Delete(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, InvalidAuthHash
+	}
+	return user, session, nil
 }
 
 // Cookies must be written before any data.
 func SetSessionCookie(w http.ResponseWriter, session *Session) {
-	// Create the cookie
-	cookie := &http.Cookie{
-		Name:     config.SessionCookieName,
-		Value:    session.Key,
-		Path:     config.SessionCookiePath,
-		Domain:   config.SessionCookieDomain,
-		Expires:  session.Expires,
-		HttpOnly: config.SessionCookieHttpOnly,
-		Secure:   config.SessionCookieSecure,
-	}
-	http.SetCookie(w, cookie)
+	setSessionCookie(w, session.Key, session.Expires)
 }
 
 // Read the http.Request object and Log in a user.
 // Returns the User and writes a session cookie to http.ResponseWriter.
 // This function must be called before anything is written to the response.
+// Use SafeRedirectURL to determine where the user should be redirected.
 func Login(w http.ResponseWriter, req *http.Request) (*User, error) {
 	// TODO Custom username and password fields
 	username := req.FormValue("username")
@@ -76,52 +103,145 @@ func Login(w http.ResponseWriter, req *http.Request) (*User, error) {
 		return nil, IncorrectPassword
 	}
 
-	// Create a new session
-	session, err := Sessions.Create(user.Id)
-	if err != nil {
+	// Keep the data of any existing session but move it to a new key to
+	// prevent session fixation
+	store := requestSessionStore(req)
+	if err = loginSession(store, user); err != nil {
 		return nil, err
 	}
 
 	// Set the cookie and return the user
-	SetSessionCookie(w, session)
+	setSessionCookie(w, store.Key(), store.Expires())
 	return user, nil
 }
 
-// Read the session cookie from the request and delete associated session
-// from the database if it exists
-func Logout(req *http.Request) error {
-	// Delete the existing session
-	sessionCookie, err := req.Cookie(config.SessionCookieName)
-	if err != nil {
-		return err
+// Get the session store of the request from the context, if the request
+// went through SessionMiddleware, or from the session cookie
+func requestSessionStore(req *http.Request) *SessionStore {
+	if store, ok := SessionStoreFromContext(req.Context()); ok {
+		return store
+	}
+	var key string
+	if cookie, err := req.Cookie(config.SessionCookieName); err == nil {
+		key = cookie.Value
 	}
+	return NewSessionStore(key)
+}
 
-	// Get the session associated with this key
-	session, err := Sessions.Get(sessionCookie.Value)
-	if err != nil {
+// Log the user in to the session store like Django's login. The session is
+// flushed if it belongs to another user or password, otherwise its key is
+// cycled.
+func loginSession(store *SessionStore, user *User) error {
+	id, ok := store.Get("_auth_user_id")
+	hash, _ := store.GetString("_auth_user_hash")
+	if ok && (fmt.Sprint(id) != strconv.FormatInt(user.Id, 10) || !user.verifySessionAuthHash(hash)) {
+		if err := store.Flush(); err != nil {
+			return err
+		}
+	} else if err := store.CycleKey(); err != nil {
 		return err
 	}
+	store.Set("_auth_user_id", strconv.FormatInt(user.Id, 10))
+	store.Set("_auth_user_backend", "django.contrib.auth.backends.ModelBackend")
+	store.Set("_auth_user_hash", user.GetSessionAuthHash())
+	return store.Save()
+}
+
+// Flush the session of the request, deleting its data and the session,
+// like Django's logout. The session cookie is deleted by SessionMiddleware;
+// if it is not used, call LogoutAndDeleteCookie instead.
+func Logout(req *http.Request) error {
+	if store, ok := SessionStoreFromContext(req.Context()); ok {
+		return store.Flush()
+	}
+	if _, err := req.Cookie(config.SessionCookieName); err != nil {
+		return nil
+	}
+	return requestSessionStore(req).Flush()
+}
 
-	// TODO Create an anonymous session?
-	return session.Delete()
+// Logout and delete the session cookie, unless SessionMiddleware will.
+// This function must be called before anything is written to the response.
+func LogoutAndDeleteCookie(w http.ResponseWriter, req *http.Request) error {
+	if err := Logout(req); err != nil {
+		return err
+	}
+	if _, ok := SessionStoreFromContext(req.Context()); ok {
+		return nil
+	}
+	if _, err := req.Cookie(config.SessionCookieName); err == nil {
+		deleteSessionCookie(w)
+	}
+	return nil
 }
 
 // Confirm that the user is logged in or redirect them to the login URL
-// TODO Attach the user to the request?
 func LoginRequired(h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return UserPassesTest(h, func(u *User) bool { return u != nil })
 }
 
-// Confirm that the user passes the given test or redirect to the login URL
+// Confirm that the user passes the given test or redirect to the login URL.
+// The user is attached to the request context given to the handler.
 func UserPassesTest(h func(http.ResponseWriter, *http.Request), test func(*User) bool) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
-		user, err := Authenticate(req)
-		// TODO 500 status for some errors?
-		if err != nil || !test(user) {
-			// TODO Set the next header
-			http.Redirect(w, req, config.LoginURL, 302)
+		user, req, err := requestUser(req)
+		if err != nil && !isAnonymous(err) {
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		if user == nil || !test(user) {
+			RedirectToLogin(w, req)
+			return
+		}
+		h(w, req)
+	}
+}
+
+// Confirm that the user is authenticated and passes the given test.
+// Unauthenticated users are redirected to the login URL. Authenticated users
+// that fail the test are also redirected, unless raise is true, in which
+// case they receive a 403 Forbidden like Django's raise_exception.
+// Database errors result in a 500 Internal Server Error.
+func userPassesTestOr403(h func(http.ResponseWriter, *http.Request), test func(*User) (bool, error), raise bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		user, req, err := requestUser(req)
+		if err != nil && !isAnonymous(err) {
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		if user == nil {
+			RedirectToLogin(w, req)
+			return
+		}
+		ok, err := test(user)
+		if err != nil {
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		if !ok {
+			if raise {
+				http.Error(w, http.StatusText(403), 403)
+			} else {
+				RedirectToLogin(w, req)
+			}
 			return
 		}
 		h(w, req)
 	}
 }
+
+// Confirm that the user has every one of the given "app_label.codename"
+// permissions. See userPassesTestOr403 for the handling of failures.
+func PermissionRequired(h func(http.ResponseWriter, *http.Request), raise bool, perms ...string) func(http.ResponseWriter, *http.Request) {
+	return userPassesTestOr403(h, func(u *User) (bool, error) { return u.HasPerms(perms...) }, raise)
+}
+
+// Confirm that the user is an active staff member
+func StaffRequired(h func(http.ResponseWriter, *http.Request), raise bool) func(http.ResponseWriter, *http.Request) {
+	return userPassesTestOr403(h, func(u *User) (bool, error) { return u.IsActive && u.IsStaff, nil }, raise)
+}
+
+// Confirm that the user is an active superuser
+func SuperuserRequired(h func(http.ResponseWriter, *http.Request), raise bool) func(http.ResponseWriter, *http.Request) {
+	return userPassesTestOr403(h, func(u *User) (bool, error) { return u.IsActive && u.IsSuperuser, nil }, raise)
+}
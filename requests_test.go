@@ -8,6 +8,7 @@ import (
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -131,3 +132,224 @@ func TestLogin(t *testing.T) {
 	}
 	expectInt(t, response.StatusCode, 200)
 }
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(`200`))
+}
+
+// Build a GET request with a session cookie for the given user, or without
+// one if the user is nil
+func sessionRequest(t *testing.T, user *User) *http.Request {
+	req, err := http.NewRequest("GET", "/protected", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != nil {
+		session, err := Sessions.CreateForUser(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: session.Key})
+	}
+	return req
+}
+
+func expectStatus(t *testing.T, h func(http.ResponseWriter, *http.Request), req *http.Request, status int) {
+	w := httptest.NewRecorder()
+	h(w, req)
+	if w.Code != status {
+		t.Errorf("Unexpected status for %s: %d != %d", req.URL, w.Code, status)
+	}
+}
+
+func TestPermissionRequired(t *testing.T) {
+	config.PasswordHasher = "md5"
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	db := createSqlitePermissionSchema(t)
+	defer db.Close()
+	if _, err := db.DB.Exec(sqliteSessionSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	staff, err := Users.CreateStaff("staff", "", "staff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := Users.CreateSuperuser("admin", "", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addUser, err := Permissions.GetByNaturalKey("auth.add_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = staff.AddPermission(addUser); err != nil {
+		t.Fatal(err)
+	}
+
+	redirect := PermissionRequired(okHandler, false, "auth.add_user")
+	forbidden := PermissionRequired(okHandler, true, "auth.add_user")
+	both := PermissionRequired(okHandler, true, "auth.add_user", "auth.delete_user")
+
+	// Unauthenticated users are always redirected
+	expectStatus(t, redirect, sessionRequest(t, nil), 302)
+	expectStatus(t, forbidden, sessionRequest(t, nil), 302)
+
+	expectStatus(t, redirect, sessionRequest(t, client), 302)
+	expectStatus(t, forbidden, sessionRequest(t, client), 403)
+	expectStatus(t, forbidden, sessionRequest(t, staff), 200)
+	expectStatus(t, both, sessionRequest(t, staff), 403)
+	expectStatus(t, both, sessionRequest(t, admin), 200)
+
+	expectStatus(t, StaffRequired(okHandler, true), sessionRequest(t, client), 403)
+	expectStatus(t, StaffRequired(okHandler, false), sessionRequest(t, staff), 200)
+	expectStatus(t, SuperuserRequired(okHandler, false), sessionRequest(t, staff), 302)
+	expectStatus(t, SuperuserRequired(okHandler, true), sessionRequest(t, admin), 200)
+}
+
+func TestAuthenticationMiddleware(t *testing.T) {
+	config.PasswordHasher = "md5"
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	db := createSqliteTestSchema(t, sqliteUserSchema, sqliteSessionSchema)
+	defer db.Close()
+
+	client, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var username string
+	var hasSession bool
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			http.Error(w, "anonymous", 401)
+			return
+		}
+		username = user.Username
+		_, hasSession = SessionFromContext(r.Context())
+
+		// Later handlers reuse the attached user without the database
+		if _, err := db.DB.Exec(`DELETE FROM "django_session"`); err != nil {
+			t.Fatal(err)
+		}
+		LoginRequired(okHandler)(w, r)
+	}
+	h := AuthenticationMiddleware(http.HandlerFunc(handler))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, sessionRequest(t, client))
+	expectInt(t, w.Code, 200)
+	expectString(t, username, "client")
+	if !hasSession {
+		t.Error("Expected a session in the request context")
+	}
+
+	// Anonymous requests are passed on without a user
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, sessionRequest(t, nil))
+	expectInt(t, w.Code, 401)
+
+	// Wrappers attach the user for their handler
+	var attached *User
+	LoginRequired(func(w http.ResponseWriter, r *http.Request) {
+		attached, _ = UserFromContext(r.Context())
+	})(httptest.NewRecorder(), sessionRequest(t, client))
+	if attached == nil || attached.Id != client.Id {
+		t.Error("Expected LoginRequired to attach the user to the request")
+	}
+}
+
+func TestLogin_CycleKey(t *testing.T) {
+	config.PasswordHasher = "md5"
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	db := createSqliteTestSchema(t, sqliteUserSchema, sqliteSessionSchema)
+	defer db.Close()
+
+	if _, err := Users.CreateUser("client", "", "client"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Users.CreateUser("other", "", "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Log in with the session cookie of the given key and return the new key
+	login := func(username, key string) string {
+		req, err := http.NewRequest("POST", "/login", strings.NewReader(url.Values{"username": {username}, "password": {username}}.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: key})
+		w := httptest.NewRecorder()
+		if _, err = Login(w, req); err != nil {
+			t.Fatal(err)
+		}
+		cookies := (&http.Response{Header: w.Header()}).Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("Unexpected length of login cookies: %d != 1", len(cookies))
+		}
+		return cookies[0].Value
+	}
+
+	// An anonymous session keeps its data but gets a new key
+	anonymous := NewSessionStore("")
+	anonymous.Set("cart", "apple")
+	if err := anonymous.Save(); err != nil {
+		t.Fatal(err)
+	}
+	key := login("client", anonymous.Key())
+	if key == anonymous.Key() {
+		t.Error("Expected the session key to change on login")
+	}
+	if exists, _ := Sessions.Exists(anonymous.Key()); exists {
+		t.Error("Expected the anonymous session to be deleted")
+	}
+	store := NewSessionStore(key)
+	cart, _ := store.GetString("cart")
+	expectString(t, cart, "apple")
+	id, _ := store.GetString("_auth_user_id")
+	expectString(t, id, "1")
+
+	// The session of another user is flushed
+	key = login("other", key)
+	store = NewSessionStore(key)
+	if store.Has("cart") {
+		t.Error("Expected the session of another user to be flushed")
+	}
+	id, _ = store.GetString("_auth_user_id")
+	expectString(t, id, "2")
+
+	// Logging out deletes the session
+	req := sessionRequest(t, nil)
+	req.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: key})
+	if err := Logout(req); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := Sessions.Exists(key); exists {
+		t.Error("Expected the session to be deleted on logout")
+	}
+
+	// The cookie can also be deleted without SessionMiddleware
+	key = login("other", "")
+	req = sessionRequest(t, nil)
+	req.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: key})
+	w := httptest.NewRecorder()
+	if err := LogoutAndDeleteCookie(w, req); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := Sessions.Exists(key); exists {
+		t.Error("Expected the session to be deleted on logout")
+	}
+	cookies := (&http.Response{Header: w.Header()}).Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Error("Expected the session cookie to be deleted on logout")
+	}
+}
@@ -0,0 +1,90 @@
+package djinn
+
+import (
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"strconv"
+	"strings"
+)
+
+// The memory limit of OpenSSL's scrypt, which Django uses by default
+const defaultScryptMaxMemory = 32 * 1024 * 1024
+
+// The scrypt hasher of Django 4.0+. Passwords are encoded like
+// "scrypt$16384$salt$8$1$hash", with the work factor N, block size r and
+// parallelism p. Like Django, hashes that need more than MaxMemory bytes are
+// neither created nor verified.
+type ScryptHasher struct {
+	BaseHasher
+	WorkFactor  int
+	BlockSize   int
+	Parallelism int
+	MaxMemory   int64 // zero uses the 32 MiB limit of OpenSSL
+}
+
+// Like OpenSSL, estimate the bytes needed to hash with the given parameters
+func (s *ScryptHasher) allowed(n, r, p int) bool {
+	maxMemory := s.MaxMemory
+	if maxMemory == 0 {
+		maxMemory = defaultScryptMaxMemory
+	}
+	return 128*int64(r)*(int64(n)+2)+128*int64(r)*int64(p) <= maxMemory
+}
+
+// Hash the cleartext with the given parameters, returning an empty string
+// if the parameters are invalid or need too much memory
+func (s *ScryptHasher) encode(cleartext, salt string, n, r, p int) string {
+	if strings.Contains(salt, "$") || !s.allowed(n, r, p) {
+		return ""
+	}
+	hashed, err := scrypt.Key([]byte(cleartext), []byte(salt), n, r, p, 64)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(
+		"%s$%d$%s$%d$%d$%s",
+		s.algorithm,
+		n,
+		salt,
+		r,
+		p,
+		base64.StdEncoding.EncodeToString(hashed),
+	)
+}
+
+func (s *ScryptHasher) Encode(cleartext, salt string) string {
+	return s.encode(cleartext, salt, s.WorkFactor, s.BlockSize, s.Parallelism)
+}
+
+func (s *ScryptHasher) Verify(cleartext, encoded string) bool {
+	// Split the saved hash apart
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != s.algorithm {
+		return false
+	}
+	params := make([]int, 3)
+	for i, part := range []string{parts[1], parts[3], parts[4]} {
+		param, err := strconv.Atoi(part)
+		if err != nil || param < 1 {
+			return false
+		}
+		params[i] = param
+	}
+
+	// Re-create the hash using the cleartext and parameters of the saved hash
+	rehash := s.encode(cleartext, parts[2], params[0], params[1], params[2])
+	return rehash != "" && ConstantTimeStringCompare(rehash, encoded)
+}
+
+// Create an scrypt hasher with the given work factor, block size and
+// parallelism
+func NewScryptHasher(n, r, p int) *ScryptHasher {
+	return &ScryptHasher{BaseHasher: BaseHasher{algorithm: "scrypt"}, WorkFactor: n, BlockSize: r, Parallelism: p}
+}
+
+func init() {
+	// The default parameters of Django's ScryptPasswordHasher
+	scrypt := NewScryptHasher(1<<14, 8, 1)
+	RegisterHasher(scrypt.algorithm, scrypt)
+}
@@ -6,7 +6,11 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"github.com/aodin/djinn/signing"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,6 +19,7 @@ var (
 	MultipleSessions    = errors.New("djinn: multiple sessions were returned")
 	BadSessionData      = errors.New("djinn: improperly formatted session data")
 	InvalidHMAC         = errors.New("djinn: the session data hmac is invalid")
+	InvalidAuthHash     = errors.New("djinn: the session auth hash does not match the user")
 )
 
 // django_session
@@ -23,6 +28,7 @@ type Session struct {
 	Data    string    `db:"session_data"`
 	Expires time.Time `db:"expire_date"`
 	manager *SessionManager
+	decoded []byte // the JSON data of a signed cookie session
 }
 
 func (s *Session) String() string {
@@ -31,143 +37,340 @@ func (s *Session) String() string {
 
 func (s *Session) Delete() error {
 	// TODO There must be a non-nil manager and database connection
-	query := fmt.Sprintf(
-		`DELETE FROM "%s" WHERE "%s" = %s`,
-		s.manager.table,
-		s.manager.primary,
-		s.manager.db.dialect.Parameter(0),
-	)
-	_, err := s.manager.db.Exec(query, s.Key)
-	return err
+	return s.manager.DeleteKey(s.Key)
 }
 
+// Decode the JSON data of the session
+func (s *Session) decode() ([]byte, error) {
+	if s.decoded != nil {
+		return s.decoded, nil
+	}
+	return decodeSession(s.Data)
+}
+
+// Decode the session data using the configuration salt and secret
+func (s *Session) SessionData() (*SessionData, error) {
+	data, err := s.decode()
+	if err != nil {
+		return nil, err
+	}
+	var sessionData SessionData
+	if err = json.Unmarshal(data, &sessionData); err != nil {
+		return nil, BadSessionData
+	}
+	return &sessionData, nil
+}
+
+// The manager of the sessions of the session engine selected by the
+// SessionEngine config
 type SessionManager struct {
-	*Manager
+	// The storage of the sessions. If nil the storage of the session engine
+	// is used.
+	Backend SessionBackend
 }
 
 // The global session manager
-// Build columns and primary keys dynamically - on init?
-var Sessions = &SessionManager{
-	&Manager{
-		db:      &connection,
-		table:   "django_session",
-		columns: []string{"session_key", "session_data", "expire_date"},
-		primary: "session_key",
-	},
-}
+var Sessions = &SessionManager{}
 
-// Get a session with an exact matching key and expire date greater than now
-func (m *SessionManager) Get(key string) (*Session, error) {
-	now := time.Now()
-
-	query := fmt.Sprintf(
-		`SELECT %s FROM "%s" WHERE "session_key" = %s AND "expire_date" >= %s`,
-		m.db.JoinColumns(m.columns),
-		m.table,
-		m.db.dialect.Parameter(0),
-		m.db.dialect.Parameter(1),
-	)
-
-	// Don't bother with a destination interface
-	rows, err := m.db.Query(query, key, now)
-	if err != nil {
-		return nil, err
+// The storage of the session engines
+var (
+	databaseSessions = NewDatabaseSessionBackend(&connection)
+	memorySessions   = NewMemorySessionBackend()
+)
+
+// The cached_db storage is built when first used, so its cache holds the
+// SessionCacheSize of the config. It is rebuilt if the size changes.
+var (
+	cachedDatabaseMutex    sync.Mutex
+	cachedDatabaseSize     int
+	cachedDatabaseSessions *CachedDatabaseSessionBackend
+)
+
+func cachedDatabaseSessionBackend() *CachedDatabaseSessionBackend {
+	cachedDatabaseMutex.Lock()
+	defer cachedDatabaseMutex.Unlock()
+	if cachedDatabaseSessions == nil || cachedDatabaseSize != config.SessionCacheSize {
+		cachedDatabaseSize = config.SessionCacheSize
+		cachedDatabaseSessions = NewCachedDatabaseSessionBackend(NewLRUCache(cachedDatabaseSize), databaseSessions)
 	}
+	return cachedDatabaseSessions
+}
 
-	// One and only one session should be returned
-	if !rows.Next() {
-		return nil, SessionDoesNotExist
+func (m *SessionManager) backend() SessionBackend {
+	if m.Backend != nil {
+		return m.Backend
 	}
-	s := &Session{
-		manager: m,
+	switch config.SessionEngine {
+	case CachedDatabaseSessions:
+		return cachedDatabaseSessionBackend()
+	case CacheSessions:
+		return memorySessions
+	case FileSessions:
+		return NewFileSessionBackend(config.SessionFilePath)
 	}
-	if err := rows.Scan(&s.Key, &s.Data, &s.Expires); err != nil {
-		return nil, err
+	return databaseSessions
+}
+
+// Get a session with an exact matching key and expire date greater than now.
+// With signed cookie sessions the key is the signed session data.
+func (m *SessionManager) Get(key string) (*Session, error) {
+	if config.SessionEngine == SignedCookieSessions {
+		return unsignCookieSession(key)
 	}
-	if rows.Next() {
-		return nil, MultipleSessions
+	session, err := m.backend().Load(key)
+	if err != nil {
+		return nil, err
 	}
-	return s, nil
+	session.manager = m
+	return session, nil
 }
 
-// Determine if a session with the given key exists in the database
-func (m *SessionManager) Exists(key string) (exists bool, err error) {
-	query := fmt.Sprintf(
-		`SELECT EXISTS(SELECT 1 FROM "%s" WHERE "session_key" = %s LIMIT 1)`,
-		m.table,
-		m.db.dialect.Parameter(0),
-	)
-	err = m.db.QueryRow(query, key).Scan(&exists)
-	return
+// Determine if a session with the given key exists
+func (m *SessionManager) Exists(key string) (bool, error) {
+	return m.backend().Exists(key)
 }
 
+// Create a session for the user with the given id.
+// Deprecated: use CreateForUser, which does not query the user.
 func (m *SessionManager) Create(userId int64) (*Session, error) {
+	user, err := Users.GetId(userId)
+	if err != nil {
+		return nil, err
+	}
+	return m.CreateForUser(user)
+}
+
+// Create a session for the given user. Like Django 1.7+ the session data
+// includes the session auth hash of the user's password.
+func (m *SessionManager) CreateForUser(user *User) (*Session, error) {
 	// Create the session data
 	data := &SessionData{
 		AuthUserBackend: "django.contrib.auth.backends.ModelBackend",
-		AuthUserId:      userId,
+		AuthUserId:      user.Id,
+		AuthUserHash:    user.GetSessionAuthHash(),
 	}
 
-	// Encode the session data using the configuration salt and secret
-	encoded, err := data.Encode(
-		[]byte(config.SessionSalt),
-		[]byte(config.Secret),
-	)
+	// Encode the session data using the configuration encoding and secret
+	b, err := signing.MarshalJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if config.SessionEngine == SignedCookieSessions {
+		return signCookieSession(b)
+	}
+	encoded, err := encodeSession(b)
 	if err != nil {
 		return nil, err
 	}
 
-	// Generate a random key - worst case is O(infinity)!
-	// But with 36 ** 32 possibilities, we'll need 10 septillion sessions
-	// before we hit the birthday bound
-	var key string
-	for {
-		key = GetRandomString(32)
-		// Confirm that this key does not already exist
-		exists, err := m.Exists(key)
-		if err != nil {
-			return nil, err
-		}
-		if !exists {
-			break
-		}
+	key, err := m.CreateKey()
+	if err != nil {
+		return nil, err
 	}
 
 	// Build the Session
 	session := &Session{
 		Key:     key,
-		Data:    string(encoded),
+		Data:    encoded,
 		Expires: time.Now().Add(config.SessionCookieAge),
 		manager: m,
 	}
 
-	// Create the query
-	query := fmt.Sprintf(
-		`INSERT INTO %s (%s) VALUES (%s)`,
-		m.table,
-		m.db.JoinColumns(m.columns),
-		m.db.BuildParameters(m.columns),
-	)
-	_, err = m.db.Exec(query, &session.Key, &session.Data, &session.Expires)
 	// Return nil on error - don't return a session if it wasn't created
-	if err != nil {
+	if err = m.backend().Save(session); err != nil {
 		return nil, err
 	}
 	return session, nil
 }
 
+// Generate a random key that does not exist yet
+func (m *SessionManager) CreateKey() (string, error) {
+	return m.backend().CreateKey()
+}
+
+// Save the encoded data of the session with the given key, creating the
+// session if it does not exist
+func (m *SessionManager) Save(key, data string, expires time.Time) error {
+	return m.backend().Save(&Session{Key: key, Data: data, Expires: expires})
+}
+
+// Delete the session with the given key if it exists. Signed cookie
+// sessions only exist in the cookie, which must be deleted instead.
+func (m *SessionManager) DeleteKey(key string) error {
+	if config.SessionEngine == SignedCookieSessions {
+		return nil
+	}
+	return m.backend().Delete(key)
+}
+
+// Delete every expired session, like Django's clearsessions command.
+// Expired signed cookie sessions are rejected by the browser and Get.
+func (m *SessionManager) ClearExpired() error {
+	if config.SessionEngine == SignedCookieSessions {
+		return nil
+	}
+	return m.backend().ClearExpired()
+}
+
+// Get the unexpired sessions of the given user, most recently saved first.
+// Since the user id is in the encoded session data, every session must be
+// loaded and decoded. Sessions that cannot be decoded are skipped. The
+// backend must be a SessionLister, which signed cookie sessions are not.
+func (m *SessionManager) ForUser(user *User) ([]*Session, error) {
+	lister, ok := m.backend().(SessionLister)
+	if !ok || config.SessionEngine == SignedCookieSessions {
+		return nil, SessionsNotListed
+	}
+	all, err := lister.All()
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*Session
+	for _, session := range all {
+		data, err := session.SessionData()
+		if err != nil || data.AuthUserId != user.Id {
+			continue
+		}
+		session.manager = m
+		sessions = append(sessions, session)
+	}
+	// Sessions expire the session cookie age after they were last saved
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Expires.After(sessions[j].Expires)
+	})
+	return sessions, nil
+}
+
+// Delete every session of the given user except the session with the given
+// key, such as the session of the current request, and return the number of
+// sessions deleted. An empty key deletes every session of the user.
+func (m *SessionManager) DeleteForUser(user *User, exceptKey string) (int, error) {
+	sessions, err := m.ForUser(user)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int
+	for _, session := range sessions {
+		if session.Key == exceptKey {
+			continue
+		}
+		if err = m.DeleteKey(session.Key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// The encodings of session data, selected by the SessionEncoding config.
+// Session data of either encoding is always decoded.
+const (
+	// The "hmac:json" base64 encoding of Django before 3.1
+	LegacyEncoding = "legacy"
+
+	// The django.core.signing encoding of Django 3.1+
+	SigningEncoding = "signing"
+)
+
+// The signing salt of django.contrib.sessions.backends.db.SessionStore
+const sessionSigningSalt = "django.contrib.sessions.SessionStore"
+
+// Signing errors mean the session data is invalid
+var BadSignature = signing.BadSignature
+
+// The signer of the session data of Django 3.1+
+func sessionSigner() *signing.TimestampSigner {
+	signer := signing.NewTimestampSigner(config.Secret)
+	signer.FallbackKeys = config.SecretKeyFallbacks
+	signer.Salt = sessionSigningSalt
+	return signer
+}
+
+// Encode the JSON session data using the encoding, salt and secret of the
+// config
+func encodeSession(data []byte) (string, error) {
+	if config.SessionEncoding == SigningEncoding {
+		return sessionSigner().SignObject(json.RawMessage(data), true)
+	}
+	return string(encodeSessionBytes([]byte(config.SessionSalt), []byte(config.Secret), data)), nil
+}
+
+// Decode session data of either encoding. Only signed session data has a
+// colon, as the legacy encoding is base64.
+func decodeSession(encoded string) ([]byte, error) {
+	if strings.Contains(encoded, ":") {
+		var data json.RawMessage
+		if err := sessionSigner().UnsignObject(encoded, 0, &data); err != nil {
+			if err == BadSignature {
+				return nil, err
+			}
+			return nil, BadSessionData
+		}
+		return data, nil
+	}
+	return decodeSessionBytesWithFallbacks([]byte(config.SessionSalt), []byte(config.Secret), encoded)
+}
+
+// Django 1.7+ stores the user id as a string and adds the auth hash
 type SessionData struct {
 	AuthUserBackend string `json:"_auth_user_backend"`
 	AuthUserId      int64  `json:"_auth_user_id"`
+	AuthUserHash    string `json:"_auth_user_hash,omitempty"`
+}
+
+// Encode the session data with the user id as a string, like Django 1.7+
+func (s *SessionData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		AuthUserBackend string `json:"_auth_user_backend"`
+		AuthUserId      string `json:"_auth_user_id"`
+		AuthUserHash    string `json:"_auth_user_hash,omitempty"`
+	}{s.AuthUserBackend, strconv.FormatInt(s.AuthUserId, 10), s.AuthUserHash})
+}
+
+// Decode the session data with a user id that is either a string, as
+// written by Django 1.7+, or a number, as written by Django 1.6
+func (s *SessionData) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		AuthUserBackend string          `json:"_auth_user_backend"`
+		AuthUserId      json.RawMessage `json:"_auth_user_id"`
+		AuthUserHash    string          `json:"_auth_user_hash"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	id, err := parseAuthUserId(raw.AuthUserId)
+	if err != nil {
+		return err
+	}
+	s.AuthUserBackend = raw.AuthUserBackend
+	s.AuthUserId = id
+	s.AuthUserHash = raw.AuthUserHash
+	return nil
+}
+
+// Parse a JSON user id that may be quoted
+func parseAuthUserId(raw []byte) (int64, error) {
+	if len(raw) == 0 {
+		return 0, BadSessionData
+	}
+	id, err := strconv.ParseInt(strings.Trim(string(raw), `"`), 10, 64)
+	if err != nil {
+		return 0, BadSessionData
+	}
+	return id, nil
 }
 
 // TODO Encode to bytes?
 func (s *SessionData) Encode(salt, secret []byte) ([]byte, error) {
-	data, err := json.Marshal(s)
+	data, err := signing.MarshalJSON(s)
 	if err != nil {
 		return nil, err
 	}
+	return encodeSessionBytes(salt, secret, data), nil
+}
 
+// Prefix the given data with its salted HMAC and encode as base64
+func encodeSessionBytes(salt, secret, data []byte) []byte {
 	// Calculate the salted hmac of the json encoded data
 	hmacd := SaltedHMAC(salt, secret, data)
 	b := bytes.Join([][]byte{hmacd, data}, []byte{':'})
@@ -175,10 +378,12 @@ func (s *SessionData) Encode(salt, secret []byte) ([]byte, error) {
 	// Encode as base64
 	dst := make([]byte, base64.StdEncoding.EncodedLen(len(b)))
 	base64.StdEncoding.Encode(dst, b)
-	return dst, nil
+	return dst
 }
 
-func DecodeSessionData(salt, secret []byte, encoded string) (*SessionData, error) {
+// Decode the base64 session data and verify its salted HMAC, returning the
+// data that was signed
+func decodeSessionBytes(salt, secret []byte, encoded string) ([]byte, error) {
 	// Decode the base64 data
 	// If you try to keep it as byte arrays, the DecodedLen method will
 	// return a maximum and there may be additional zero bytes
@@ -195,18 +400,40 @@ func DecodeSessionData(salt, secret []byte, encoded string) (*SessionData, error
 
 	// Re-calculate the HMAC
 	rehmac := SaltedHMAC(salt, secret, parts[1])
-	// log.Println(rehmac)
 
 	// Constant time compare the given and calculated hmacs
 	if !hmac.Equal(parts[0], rehmac) {
 		return nil, InvalidHMAC
 	}
+	return parts[1], nil
+}
+
+// Decode the session data with the given secret, then try each of the
+// SecretKeyFallbacks of the config if the HMAC does not match
+func decodeSessionBytesWithFallbacks(salt, secret []byte, encoded string) ([]byte, error) {
+	data, err := decodeSessionBytes(salt, secret, encoded)
+	for _, fallback := range config.SecretKeyFallbacks {
+		if err != InvalidHMAC {
+			break
+		}
+		data, err = decodeSessionBytes(salt, []byte(fallback), encoded)
+	}
+	return data, err
+}
+
+// Decode the session data with the given salt and secret or any of the
+// SecretKeyFallbacks of the config
+func DecodeSessionData(salt, secret []byte, encoded string) (*SessionData, error) {
+	data, err := decodeSessionBytesWithFallbacks(salt, secret, encoded)
+	if err != nil {
+		return nil, err
+	}
 
 	// Decode the session data
 	// Python's pickle is close enough to json that default data works
 	// As of Django 1.6, the default session serializer is JSON
 	var sessionData SessionData
-	if err = json.Unmarshal(parts[1], &sessionData); err != nil {
+	if err = json.Unmarshal(data, &sessionData); err != nil {
 		return nil, BadSessionData
 	}
 
@@ -2,8 +2,11 @@ package djinn
 
 import (
 	"bytes"
+	"encoding/json"
 	_ "github.com/lib/pq"
+	"net/http"
 	"testing"
+	"time"
 )
 
 var sqliteSessionSchema = `CREATE TABLE "django_session" (
@@ -28,8 +31,13 @@ func TestSessions(t *testing.T) {
 	db := createSqliteTestSchema(t, sqliteUserSchema, sqliteSessionSchema)
 	defer db.Close()
 
+	user, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	// Create a new configuration
-	session, err := Sessions.Create(1)
+	session, err := Sessions.CreateForUser(user)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -47,6 +55,20 @@ func TestSessions(t *testing.T) {
 	}
 	expectString(t, data.AuthUserBackend, "django.contrib.auth.backends.ModelBackend")
 	expectInt64(t, data.AuthUserId, 1)
+	expectString(t, data.AuthUserHash, user.GetSessionAuthHash())
+
+	// Sessions can still be created by user id
+	session, err = Sessions.Create(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = DecodeSessionData(salt, secret, session.Data); err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, data.AuthUserHash, user.GetSessionAuthHash())
+	if _, err = Sessions.Create(404); err != UserDoesNotExist {
+		t.Error("Expected a UserDoesNotExist error, but one did not occur")
+	}
 
 	// A session key that does not exist should generate an error
 	s, err = Sessions.Get("A")
@@ -69,7 +91,8 @@ func TestSessionData_Encode(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	expected := []byte(`MWUyODNhYmI1YWYzNDliZTA5NDc3MWVkODdjMTUyOWRkNWE0ZGU2NTp7Il9hdXRoX3VzZXJfYmFja2VuZCI6ImRqYW5nby5jb250cmliLmF1dGguYmFja2VuZHMuTW9kZWxCYWNrZW5kIiwiX2F1dGhfdXNlcl9pZCI6MX0=`)
+	// Like Django 1.7+ the user id is encoded as a string
+	expected := []byte(`YjBkNjdlOTA4ZjJiMWY4MjY4OTAxNzg3YzU1NmI1MTA1NGYzNzUyYTp7Il9hdXRoX3VzZXJfYmFja2VuZCI6ImRqYW5nby5jb250cmliLmF1dGguYmFja2VuZHMuTW9kZWxCYWNrZW5kIiwiX2F1dGhfdXNlcl9pZCI6IjEifQ==`)
 	if bytes.Compare(d, expected) != 0 {
 		t.Errorf("Unexpected encoded session data: %s != %s", d, expected)
 	}
@@ -96,3 +119,335 @@ func TestDecodeSessionData(t *testing.T) {
 		t.Errorf("Unexpected auth user id: %d != %d", data.AuthUserId, expectedAuthUserId)
 	}
 }
+
+func TestDecodeSessionData_Django17(t *testing.T) {
+	salt := []byte(`django.contrib.sessionsSessionStore`)
+	secret := []byte(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	// Django 1.7+ stores the user id as a string
+	data := []byte(`{"_auth_user_hash":"a9ae6ca3e8c4d0d9a6ac5cd1cf5a8afd7f5e9e1d","_auth_user_backend":"django.contrib.auth.backends.ModelBackend","_auth_user_id":"42"}`)
+	encoded := encodeSessionBytes(salt, secret, data)
+
+	sessionData, err := DecodeSessionData(salt, secret, string(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, sessionData.AuthUserId, 42)
+	expectString(t, sessionData.AuthUserHash, "a9ae6ca3e8c4d0d9a6ac5cd1cf5a8afd7f5e9e1d")
+
+	data = []byte(`{"_auth_user_id":"forty-two"}`)
+	encoded = encodeSessionBytes(salt, secret, data)
+	if _, err = DecodeSessionData(salt, secret, string(encoded)); err != BadSessionData {
+		t.Error("Expected a BadSessionData error, but one did not occur")
+	}
+}
+
+func TestSecretKeyFallbacks(t *testing.T) {
+	config.PasswordHasher = "md5"
+	SetSecret("new-secret")
+	defer func() { config.SecretKeyFallbacks = nil }()
+
+	db := createSqliteTestSchema(t, sqliteUserSchema, sqliteSessionSchema)
+	defer db.Close()
+
+	user, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create legacy and signed sessions with the old secret
+	SetSecret("old-secret")
+	legacy := sessionRequest(t, user)
+	config.SessionEncoding = SigningEncoding
+	signed := sessionRequest(t, user)
+	config.SessionEncoding = LegacyEncoding
+	SetSecret("new-secret")
+
+	config.SecretKeyFallbacks = []string{"other-secret", "old-secret"}
+	for _, req := range []*http.Request{legacy, signed} {
+		if _, err = Authenticate(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without the fallback the sessions are invalid
+	config.SecretKeyFallbacks = nil
+	for _, req := range []*http.Request{legacy, signed} {
+		if _, err = Authenticate(req); err == nil {
+			t.Error("Expected an error without the fallback, but one did not occur")
+		}
+	}
+
+	// New session data is always encoded with the current secret
+	encoded, err := encodeSession([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = decodeSessionBytes([]byte(config.SessionSalt), []byte("new-secret"), encoded); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionAuthHash(t *testing.T) {
+	config.PasswordHasher = "md5"
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	db := createSqliteTestSchema(t, sqliteUserSchema, sqliteSessionSchema)
+	defer db.Close()
+
+	user, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Calculated by Django's AbstractBaseUser.get_session_auth_hash
+	user.Password = "md5$BD03RxMbKE9o$7de5de2fb33be2b11dee2e016517df5a"
+	expectString(t, user.GetSessionAuthHash(), "c28dcc5a5258485eb2e3740b218a3ba533688265")
+	if err = user.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := sessionRequest(t, user)
+	if _, err = Authenticate(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the password invalidates the session
+	hasher, _ := GetHasher("md5")
+	user.Password = MakePassword(hasher, "changed")
+	if err = user.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Authenticate(req); err != InvalidAuthHash {
+		t.Errorf("Expected an InvalidAuthHash error, received %v", err)
+	}
+
+	// And deletes it
+	cookie, _ := req.Cookie(config.SessionCookieName)
+	if _, err = Sessions.Get(cookie.Value); err != SessionDoesNotExist {
+		t.Error("Expected the invalidated session to be deleted")
+	}
+}
+
+func TestDecodeSession_Signing(t *testing.T) {
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	// Compressed session data signed by Django 3.1+
+	signed := `.eJyrVopPLC3JiC8tTi2Kz0xRslIyVNJBFktKTM5OzQNJpGQl5qXn6yXn55UUZSbpgZToQWWL9XzzU1JznKBqUQzISCzOAOpOTEoGiicnFpUoWUUrJRYU5KQC-YOTjq0FAAlyXHs:1r31eq:Iz47Db6XYvkg6lS0rGzlQ7WGz1TtHJUV2GrBqUy0J_4`
+	session := &Session{Data: signed}
+	store, err := session.Store()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := store.GetString("_auth_user_id")
+	expectString(t, id, "1")
+	expectInt(t, store.Len(), 4)
+
+	data, err := session.SessionData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, data.AuthUserId, 1)
+
+	SetSecret("wrong")
+	defer SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+	if _, err = session.SessionData(); err != BadSignature {
+		t.Error("Expected a BadSignature error, but one did not occur")
+	}
+}
+
+func TestSigningSessionEncoding(t *testing.T) {
+	config.PasswordHasher = "md5"
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+	config.SessionEncoding = SigningEncoding
+	config.SessionAuthHashAlgorithm = "sha256"
+	defer func() {
+		config.SessionEncoding = LegacyEncoding
+		config.SessionAuthHashAlgorithm = "sha1"
+	}()
+
+	db := createSqliteTestSchema(t, sqliteUserSchema, sqliteSessionSchema)
+	defer db.Close()
+
+	user, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Django 3.1+ uses sha256 for the session auth hash
+	user.Password = "md5$BD03RxMbKE9o$7de5de2fb33be2b11dee2e016517df5a"
+	expectString(t, user.GetSessionAuthHash(), "2592bba6408cc65dcab2ccfefe9c3554e93e9d323f140d4b045caca4bf084fff")
+
+	// The algorithm does not depend on the session encoding
+	config.SessionEncoding = LegacyEncoding
+	expectString(t, user.GetSessionAuthHash(), "2592bba6408cc65dcab2ccfefe9c3554e93e9d323f140d4b045caca4bf084fff")
+	config.SessionAuthHashAlgorithm = "sha1"
+	sha1Hash := user.GetSessionAuthHash()
+	config.SessionEncoding = SigningEncoding
+	expectString(t, user.GetSessionAuthHash(), sha1Hash)
+	config.SessionAuthHashAlgorithm = "sha256"
+	if err = user.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := Sessions.CreateForUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw json.RawMessage
+	if err = sessionSigner().UnsignObject(session.Data, 0, &raw); err != nil {
+		t.Fatal(err)
+	}
+	req := sessionRequest(t, user)
+	if _, err = Authenticate(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// Legacy sessions are still decoded
+	config.SessionEncoding = LegacyEncoding
+	req = sessionRequest(t, user)
+	config.SessionEncoding = SigningEncoding
+	if _, err = Authenticate(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionManager_ForUser(t *testing.T) {
+	config.PasswordHasher = "md5"
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	db := createSqliteTestSchema(t, sqliteUserSchema, sqliteSessionSchema)
+	defer db.Close()
+
+	client, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Users.CreateUser("other", "", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, user := range []*User{client, client, other} {
+		session, err := Sessions.CreateForUser(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, session.Key)
+	}
+	anonymous := NewSessionStore("")
+	anonymous.Set("cart", "apple")
+	if err = anonymous.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := Sessions.ForUser(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt(t, len(sessions), 2)
+	for _, session := range sessions {
+		if session.Expires.IsZero() {
+			t.Error("Expected the sessions to have an expiration")
+		}
+	}
+
+	// Revoke every other session of the user
+	deleted, err := Sessions.DeleteForUser(client, keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt(t, deleted, 1)
+	if sessions, err = Sessions.ForUser(client); err != nil {
+		t.Fatal(err)
+	}
+	expectInt(t, len(sessions), 1)
+	expectString(t, sessions[0].Key, keys[0])
+
+	// Revoke every session of the user
+	if deleted, err = Sessions.DeleteForUser(client, ""); err != nil {
+		t.Fatal(err)
+	}
+	expectInt(t, deleted, 1)
+	for _, key := range []string{keys[2], anonymous.Key()} {
+		if exists, _ := Sessions.Exists(key); !exists {
+			t.Errorf("Expected the session %s to remain", key)
+		}
+	}
+
+	// Signed cookie sessions cannot be listed
+	config.SessionEngine = SignedCookieSessions
+	defer func() { config.SessionEngine = DatabaseSessions }()
+	if _, err = Sessions.ForUser(client); err != SessionsNotListed {
+		t.Error("Expected a SessionsNotListed error, but one did not occur")
+	}
+}
+
+func TestAuthenticate_MissingAuthHash(t *testing.T) {
+	config.PasswordHasher = "md5"
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	db := createSqliteTestSchema(t, sqliteUserSchema, sqliteSessionSchema)
+	defer db.Close()
+
+	user, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A Django 1.6 session without an auth hash
+	hashless := func() *http.Request {
+		data := &SessionData{
+			AuthUserBackend: "django.contrib.auth.backends.ModelBackend",
+			AuthUserId:      user.Id,
+		}
+		encoded, err := data.Encode([]byte(config.SessionSalt), []byte(config.Secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = Sessions.Save("hashless", string(encoded), time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		req := sessionRequest(t, nil)
+		req.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: "hashless"})
+		return req
+	}
+
+	// Sessions without a hash are deleted
+	if _, err = Authenticate(hashless()); err != InvalidAuthHash {
+		t.Error("Expected an InvalidAuthHash error, but one did not occur")
+	}
+	if exists, _ := Sessions.Exists("hashless"); exists {
+		t.Error("Expected the session without a hash to be deleted")
+	}
+
+	// Unless they are explicitly allowed
+	config.AllowSessionsWithoutAuthHash = true
+	defer func() { config.AllowSessionsWithoutAuthHash = false }()
+	if _, err = Authenticate(hashless()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionManager_Create_UserId(t *testing.T) {
+	config.PasswordHasher = "md5"
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	db := createSqliteTestSchema(t, sqliteUserSchema, sqliteSessionSchema)
+	defer db.Close()
+
+	user, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := Sessions.CreateForUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Like the session store of Login, the user id is written as a string
+	id, _ := NewSessionStore(session.Key).Get("_auth_user_id")
+	if _, ok := id.(string); !ok {
+		t.Errorf("Expected the user id to be a string, received %T", id)
+	}
+}
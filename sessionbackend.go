@@ -0,0 +1,390 @@
+package djinn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	InvalidSessionKey = errors.New("djinn: invalid characters in the session key")
+	SessionsNotListed = errors.New("djinn: the session backend cannot list sessions")
+)
+
+// The session engines, selected by the SessionEngine config
+const (
+	// Sessions stored in the django_session table, like
+	// django.contrib.sessions.backends.db
+	DatabaseSessions = "db"
+
+	// Sessions stored in the django_session table and cached in memory,
+	// like django.contrib.sessions.backends.cached_db
+	CachedDatabaseSessions = "cached_db"
+
+	// Sessions stored in files of the SessionFilePath directory, like
+	// django.contrib.sessions.backends.file
+	FileSessions = "file"
+
+	// Sessions stored in the memory of the process, like
+	// django.contrib.sessions.backends.cache with a local memory cache.
+	// They are lost when the process exits.
+	CacheSessions = "cache"
+
+	// Sessions stored entirely in the signed session cookie, like
+	// django.contrib.sessions.backends.signed_cookies. No database access
+	// is needed to read them, but they cannot be revoked before they expire.
+	SignedCookieSessions = "signed_cookies"
+)
+
+// A SessionBackend stores the encoded data of sessions by their key, like
+// the session engines of django.contrib.sessions.backends
+type SessionBackend interface {
+	// Load the unexpired session with the given key. Sessions that do not
+	// exist or have expired return SessionDoesNotExist.
+	Load(key string) (*Session, error)
+
+	// Save the key, data and expiration of the session, creating it if it
+	// does not exist
+	Save(session *Session) error
+
+	// Does a session with the given key exist?
+	Exists(key string) (bool, error)
+
+	// Delete the session with the given key if it exists
+	Delete(key string) error
+
+	// Generate a random key that does not exist yet
+	CreateKey() (string, error)
+
+	// Delete every expired session
+	ClearExpired() error
+}
+
+// A SessionBackend that can list its sessions, which is needed to find the
+// sessions of a user
+type SessionLister interface {
+	// Get every unexpired session
+	All() ([]*Session, error)
+}
+
+// Generate a random key that does not exist in the given backend
+func createSessionKey(backend SessionBackend) (string, error) {
+	// Generate a random key - worst case is O(infinity)!
+	// But with 36 ** 32 possibilities, we'll need 10 septillion sessions
+	// before we hit the birthday bound
+	for {
+		key := GetRandomString(32)
+		// Confirm that this key does not already exist
+		exists, err := backend.Exists(key)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return key, nil
+		}
+	}
+}
+
+// Stores sessions in the django_session table, where Django can read them
+type DatabaseSessionBackend struct {
+	*Manager
+}
+
+// Create a backend for the django_session table of the given database
+func NewDatabaseSessionBackend(db *DB) *DatabaseSessionBackend {
+	return &DatabaseSessionBackend{
+		&Manager{
+			db:      db,
+			table:   "django_session",
+			columns: []string{"session_key", "session_data", "expire_date"},
+			primary: "session_key",
+		},
+	}
+}
+
+// Get a session with an exact matching key and expire date greater than now
+func (b *DatabaseSessionBackend) Load(key string) (*Session, error) {
+	now := time.Now()
+
+	query := fmt.Sprintf(
+		`SELECT %s FROM "%s" WHERE "session_key" = %s AND "expire_date" >= %s`,
+		b.db.JoinColumns(b.columns),
+		b.table,
+		b.db.dialect.Parameter(0),
+		b.db.dialect.Parameter(1),
+	)
+
+	// Don't bother with a destination interface
+	rows, err := b.db.Query(query, key, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// One and only one session should be returned
+	if !rows.Next() {
+		return nil, SessionDoesNotExist
+	}
+	s := &Session{}
+	if err := rows.Scan(&s.Key, &s.Data, &s.Expires); err != nil {
+		return nil, err
+	}
+	if rows.Next() {
+		return nil, MultipleSessions
+	}
+	return s, nil
+}
+
+// Get every session with an expire date greater than now
+func (b *DatabaseSessionBackend) All() ([]*Session, error) {
+	query := fmt.Sprintf(
+		`SELECT %s FROM "%s" WHERE "expire_date" >= %s`,
+		b.db.JoinColumns(b.columns),
+		b.table,
+		b.db.dialect.Parameter(0),
+	)
+	rows, err := b.db.Query(query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []*Session
+	for rows.Next() {
+		s := &Session{}
+		if err = rows.Scan(&s.Key, &s.Data, &s.Expires); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// Update the session, inserting it if it does not exist
+func (b *DatabaseSessionBackend) Save(session *Session) error {
+	query := fmt.Sprintf(
+		`UPDATE "%s" SET "session_data" = %s, "expire_date" = %s WHERE "session_key" = %s`,
+		b.table,
+		b.db.dialect.Parameter(0),
+		b.db.dialect.Parameter(1),
+		b.db.dialect.Parameter(2),
+	)
+	result, err := b.db.Exec(query, session.Data, session.Expires, session.Key)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated > 0 {
+		return err
+	}
+	query = fmt.Sprintf(
+		`INSERT INTO "%s" (%s) VALUES (%s)`,
+		b.table,
+		b.db.JoinColumns(b.columns),
+		b.db.BuildParameters(b.columns),
+	)
+	_, err = b.db.Exec(query, session.Key, session.Data, session.Expires)
+	return err
+}
+
+// Determine if a session with the given key exists in the database
+func (b *DatabaseSessionBackend) Exists(key string) (exists bool, err error) {
+	query := fmt.Sprintf(
+		`SELECT EXISTS(SELECT 1 FROM "%s" WHERE "session_key" = %s LIMIT 1)`,
+		b.table,
+		b.db.dialect.Parameter(0),
+	)
+	err = b.db.QueryRow(query, key).Scan(&exists)
+	return
+}
+
+func (b *DatabaseSessionBackend) Delete(key string) error {
+	query := fmt.Sprintf(
+		`DELETE FROM "%s" WHERE "%s" = %s`,
+		b.table,
+		b.primary,
+		b.db.dialect.Parameter(0),
+	)
+	_, err := b.db.Exec(query, key)
+	return err
+}
+
+func (b *DatabaseSessionBackend) CreateKey() (string, error) {
+	return createSessionKey(b)
+}
+
+func (b *DatabaseSessionBackend) ClearExpired() error {
+	query := fmt.Sprintf(
+		`DELETE FROM "%s" WHERE "expire_date" < %s`,
+		b.table,
+		b.db.dialect.Parameter(0),
+	)
+	_, err := b.db.Exec(query, time.Now())
+	return err
+}
+
+// Stores sessions in memory, which is useful for tests and single process
+// deployments. It is safe for concurrent use.
+type MemorySessionBackend struct {
+	mutex    sync.RWMutex
+	sessions map[string]Session
+}
+
+func NewMemorySessionBackend() *MemorySessionBackend {
+	return &MemorySessionBackend{sessions: make(map[string]Session)}
+}
+
+func (b *MemorySessionBackend) Load(key string) (*Session, error) {
+	b.mutex.RLock()
+	session, ok := b.sessions[key]
+	b.mutex.RUnlock()
+	if !ok || session.Expires.Before(time.Now()) {
+		return nil, SessionDoesNotExist
+	}
+	return &session, nil
+}
+
+func (b *MemorySessionBackend) All() ([]*Session, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	now := time.Now()
+	var sessions []*Session
+	for _, session := range b.sessions {
+		if !session.Expires.Before(now) {
+			s := session
+			sessions = append(sessions, &s)
+		}
+	}
+	return sessions, nil
+}
+
+func (b *MemorySessionBackend) Save(session *Session) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.sessions[session.Key] = Session{
+		Key:     session.Key,
+		Data:    session.Data,
+		Expires: session.Expires,
+	}
+	return nil
+}
+
+func (b *MemorySessionBackend) Exists(key string) (bool, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	_, ok := b.sessions[key]
+	return ok, nil
+}
+
+func (b *MemorySessionBackend) Delete(key string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.sessions, key)
+	return nil
+}
+
+func (b *MemorySessionBackend) CreateKey() (string, error) {
+	return createSessionKey(b)
+}
+
+func (b *MemorySessionBackend) ClearExpired() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	for key, session := range b.sessions {
+		if session.Expires.Before(now) {
+			delete(b.sessions, key)
+		}
+	}
+	return nil
+}
+
+// The cache key prefix of django.contrib.sessions.backends.cached_db
+const cachedDatabaseKeyPrefix = "django.contrib.sessions.cached_db"
+
+// The cached data and expiration of a session
+type cachedSession struct {
+	Data    string    `json:"data"`
+	Expires time.Time `json:"expires"`
+}
+
+// Caches the sessions of another backend, usually the database, like
+// Django's cached_db backend. Sessions are written to both the cache and
+// the backend, and only loaded from the backend if they are not cached.
+// Unless the cache is shared, sessions deleted by another process, such as
+// Django, remain valid until they expire from the cache.
+type CachedDatabaseSessionBackend struct {
+	Cache    Cache
+	Database SessionBackend
+}
+
+func NewCachedDatabaseSessionBackend(cache Cache, database SessionBackend) *CachedDatabaseSessionBackend {
+	return &CachedDatabaseSessionBackend{Cache: cache, Database: database}
+}
+
+// Cache the session until it expires
+func (b *CachedDatabaseSessionBackend) cache(session *Session) {
+	timeout := session.Expires.Sub(time.Now())
+	if timeout <= 0 {
+		return
+	}
+	value, err := json.Marshal(cachedSession{Data: session.Data, Expires: session.Expires})
+	if err != nil {
+		return
+	}
+	b.Cache.Set(cachedDatabaseKeyPrefix+session.Key, value, timeout)
+}
+
+func (b *CachedDatabaseSessionBackend) Load(key string) (*Session, error) {
+	if value, ok := b.Cache.Get(cachedDatabaseKeyPrefix + key); ok {
+		var cached cachedSession
+		if err := json.Unmarshal(value, &cached); err == nil && cached.Expires.After(time.Now()) {
+			return &Session{Key: key, Data: cached.Data, Expires: cached.Expires}, nil
+		}
+	}
+	session, err := b.Database.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	b.cache(session)
+	return session, nil
+}
+
+// List the sessions of the backend, if it can list sessions
+func (b *CachedDatabaseSessionBackend) All() ([]*Session, error) {
+	lister, ok := b.Database.(SessionLister)
+	if !ok {
+		return nil, SessionsNotListed
+	}
+	return lister.All()
+}
+
+func (b *CachedDatabaseSessionBackend) Save(session *Session) error {
+	if err := b.Database.Save(session); err != nil {
+		return err
+	}
+	b.cache(session)
+	return nil
+}
+
+func (b *CachedDatabaseSessionBackend) Exists(key string) (bool, error) {
+	if _, ok := b.Cache.Get(cachedDatabaseKeyPrefix + key); ok {
+		return true, nil
+	}
+	return b.Database.Exists(key)
+}
+
+func (b *CachedDatabaseSessionBackend) Delete(key string) error {
+	b.Cache.Delete(cachedDatabaseKeyPrefix + key)
+	return b.Database.Delete(key)
+}
+
+func (b *CachedDatabaseSessionBackend) CreateKey() (string, error) {
+	return createSessionKey(b)
+}
+
+// Expired sessions are cleared from the backend. They expire from the cache
+// on their own.
+func (b *CachedDatabaseSessionBackend) ClearExpired() error {
+	return b.Database.ClearExpired()
+}
@@ -0,0 +1,228 @@
+package djinn
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test the behavior shared by every session backend
+func testSessionBackend(t *testing.T, backend SessionBackend) {
+	key, err := backend.CreateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt(t, len(key), 32)
+	if _, err = backend.Load(key); err != SessionDoesNotExist {
+		t.Error("Expected a SessionDoesNotExist error, but one did not occur")
+	}
+
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err = backend.Save(&Session{Key: key, Data: "data", Expires: expires}); err != nil {
+		t.Fatal(err)
+	}
+	exists, err := backend.Exists(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Error("Expected the session to exist")
+	}
+	session, err := backend.Load(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, session.Key, key)
+	expectString(t, session.Data, "data")
+	if !session.Expires.Equal(expires) {
+		t.Errorf("Unexpected expiration: %s != %s", session.Expires, expires)
+	}
+
+	// Saving an existing session replaces it
+	if err = backend.Save(&Session{Key: key, Data: "updated", Expires: expires}); err != nil {
+		t.Fatal(err)
+	}
+	if session, err = backend.Load(key); err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, session.Data, "updated")
+
+	// Expired sessions are not loaded and are deleted by ClearExpired
+	expired, err := backend.CreateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = backend.Save(&Session{Key: expired, Data: "data", Expires: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = backend.Load(expired); err != SessionDoesNotExist {
+		t.Error("Expected a SessionDoesNotExist error for an expired session, but one did not occur")
+	}
+	if err = backend.ClearExpired(); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ = backend.Exists(expired); exists {
+		t.Error("Expected the expired session to be cleared")
+	}
+	if exists, _ = backend.Exists(key); !exists {
+		t.Error("Expected the unexpired session to remain")
+	}
+
+	// Only unexpired sessions are listed
+	if lister, ok := backend.(SessionLister); ok {
+		sessions, err := lister.All()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectInt(t, len(sessions), 1)
+	}
+
+	if err = backend.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = backend.Load(key); err != SessionDoesNotExist {
+		t.Error("Expected a SessionDoesNotExist error, but one did not occur")
+	}
+	if err = backend.Delete(key); err != nil {
+		t.Errorf("Unexpected error deleting a missing session: %s", err)
+	}
+}
+
+func TestDatabaseSessionBackend(t *testing.T) {
+	db := createSqliteTestSchema(t, sqliteSessionSchema)
+	defer db.Close()
+	testSessionBackend(t, NewDatabaseSessionBackend(db))
+}
+
+func TestMemorySessionBackend(t *testing.T) {
+	config.PasswordHasher = "md5"
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	backend := NewMemorySessionBackend()
+	testSessionBackend(t, backend)
+
+	// Sessions can be authenticated without the django_session table
+	db := createSqliteTestSchema(t, sqliteUserSchema)
+	defer db.Close()
+	Sessions.Backend = backend
+	defer func() { Sessions.Backend = nil }()
+
+	user, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Authenticate(sessionRequest(t, user)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSessionBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "djinn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	backend := NewFileSessionBackend(dir)
+	testSessionBackend(t, backend)
+
+	// Keys cannot escape the directory
+	for _, key := range []string{"", "../secret", "ABC"} {
+		if _, err = backend.Load(key); err != SessionDoesNotExist {
+			t.Errorf("Expected a SessionDoesNotExist error for %q, but one did not occur", key)
+		}
+		if err = backend.Save(&Session{Key: key, Expires: time.Now()}); err != InvalidSessionKey {
+			t.Errorf("Expected an InvalidSessionKey error for %q, but one did not occur", key)
+		}
+	}
+
+	// Sessions are files named by the cookie name and key, like Django
+	key, err := backend.CreateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = backend.Save(&Session{Key: key, Data: "data", Expires: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(dir, config.SessionCookieName+key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, string(contents), "data")
+
+	// The session engine uses the configured path
+	config.SessionEngine = FileSessions
+	config.SessionFilePath = dir
+	defer func() {
+		config.SessionEngine = DatabaseSessions
+		config.SessionFilePath = ""
+	}()
+	session, err := Sessions.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, session.Data, "data")
+}
+
+func TestCachedDatabaseSessionBackend(t *testing.T) {
+	db := createSqliteTestSchema(t, sqliteSessionSchema)
+	defer db.Close()
+
+	backend := NewCachedDatabaseSessionBackend(NewLRUCache(100), NewDatabaseSessionBackend(db))
+	testSessionBackend(t, backend)
+
+	// Saved sessions are written through to the database
+	key, err := backend.CreateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{Key: key, Data: "data", Expires: time.Now().Add(time.Hour)}
+	if err = backend.Save(session); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = backend.Database.Load(key); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cached sessions are loaded without the database
+	if err = backend.Database.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if session, err = backend.Load(key); err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, session.Data, "data")
+
+	// Sessions that are not cached are loaded from the database and cached
+	cache := NewLRUCache(100)
+	backend.Cache = cache
+	if err = backend.Database.Save(session); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = backend.Load(key); err != nil {
+		t.Fatal(err)
+	}
+	expectInt(t, cache.Len(), 1)
+}
+
+func TestCachedDatabaseSessions_CacheSize(t *testing.T) {
+	config.SessionEngine = CachedDatabaseSessions
+	config.SessionCacheSize = 1
+	defer func() {
+		config.SessionEngine = DatabaseSessions
+		config.SessionCacheSize = 10000
+	}()
+
+	backend := Sessions.backend().(*CachedDatabaseSessionBackend)
+	expectInt(t, backend.Cache.(*LRUCache).size, 1)
+	if Sessions.backend() != backend {
+		t.Error("Expected the cached_db backend to be reused")
+	}
+
+	// A new size builds a new cache
+	config.SessionCacheSize = 2
+	backend = Sessions.backend().(*CachedDatabaseSessionBackend)
+	expectInt(t, backend.Cache.(*LRUCache).size, 2)
+}
@@ -0,0 +1,180 @@
+package djinn
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Stores sessions in files like django.contrib.sessions.backends.file.
+// Each session is a file of its encoded data named by the session cookie
+// name and key. As in Django, a session expires the session cookie age after
+// its file was last modified, so Go and Django can share the directory.
+type FileSessionBackend struct {
+	Path string
+}
+
+// Create a backend for the given directory. An empty path uses the
+// temporary directory, like Django.
+func NewFileSessionBackend(path string) *FileSessionBackend {
+	if path == "" {
+		path = os.TempDir()
+	}
+	return &FileSessionBackend{Path: path}
+}
+
+// Get the filename of the session with the given key. Only keys of
+// lowercase letters and digits are valid, which prevents path traversal.
+func (b *FileSessionBackend) filename(key string) (string, error) {
+	if key == "" {
+		return "", InvalidSessionKey
+	}
+	for _, c := range key {
+		if !strings.ContainsRune(string(validChars), c) {
+			return "", InvalidSessionKey
+		}
+	}
+	return filepath.Join(b.Path, config.SessionCookieName+key), nil
+}
+
+// Sessions with invalid keys do not exist. Expired sessions are deleted.
+func (b *FileSessionBackend) Load(key string) (*Session, error) {
+	filename, err := b.filename(key)
+	if err != nil {
+		return nil, SessionDoesNotExist
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, SessionDoesNotExist
+		}
+		return nil, err
+	}
+	expires := info.ModTime().Add(config.SessionCookieAge)
+	if expires.Before(time.Now()) {
+		if err = b.Delete(key); err != nil {
+			return nil, err
+		}
+		return nil, SessionDoesNotExist
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, SessionDoesNotExist
+		}
+		return nil, err
+	}
+	return &Session{Key: key, Data: string(data), Expires: expires}, nil
+}
+
+// Load every unexpired session in the directory
+func (b *FileSessionBackend) All() ([]*Session, error) {
+	files, err := ioutil.ReadDir(b.Path)
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*Session
+	for _, info := range files {
+		key := strings.TrimPrefix(info.Name(), config.SessionCookieName)
+		if info.IsDir() || key == info.Name() {
+			continue
+		}
+		if _, err := b.filename(key); err != nil {
+			continue
+		}
+		session, err := b.Load(key)
+		if err == SessionDoesNotExist {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// Write the session data to a temporary file which then replaces the
+// session file. The modification time is set so that the session expires
+// at its expiration.
+func (b *FileSessionBackend) Save(session *Session) error {
+	filename, err := b.filename(session.Key)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(b.Path, filepath.Base(filename)+"_")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(session.Data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		modified := session.Expires.Add(-config.SessionCookieAge)
+		err = os.Chtimes(f.Name(), modified, modified)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (b *FileSessionBackend) Exists(key string) (bool, error) {
+	filename, err := b.filename(key)
+	if err != nil {
+		return false, nil
+	}
+	if _, err = os.Stat(filename); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *FileSessionBackend) Delete(key string) error {
+	filename, err := b.filename(key)
+	if err != nil {
+		return nil
+	}
+	if err = os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (b *FileSessionBackend) CreateKey() (string, error) {
+	return createSessionKey(b)
+}
+
+// Delete the session files that have expired. Other files in the directory,
+// including temporary files that are being written, are ignored.
+func (b *FileSessionBackend) ClearExpired() error {
+	files, err := ioutil.ReadDir(b.Path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, info := range files {
+		key := strings.TrimPrefix(info.Name(), config.SessionCookieName)
+		if info.IsDir() || key == info.Name() {
+			continue
+		}
+		if _, err := b.filename(key); err != nil {
+			continue
+		}
+		if info.ModTime().Add(config.SessionCookieAge).Before(now) {
+			if err = b.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
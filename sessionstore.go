@@ -0,0 +1,269 @@
+package djinn
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/aodin/djinn/signing"
+	"sort"
+	"time"
+)
+
+// A SessionStore holds the arbitrary JSON compatible data of a session,
+// including any keys written by Django. Like Django's SessionBase it tracks
+// whether the data was accessed or modified so it is only saved when needed.
+// Numbers are kept as json.Number so they are re-encoded exactly as given.
+// The data of an existing session is loaded on first access.
+type SessionStore struct {
+	key      string
+	data     map[string]interface{}
+	expires  time.Time
+	err      error
+	Accessed bool
+	Modified bool
+}
+
+// Create a store for the session with the given key, or a new session if
+// the key is empty
+func NewSessionStore(key string) *SessionStore {
+	return &SessionStore{key: key}
+}
+
+// Load the session data if it has not been loaded. Sessions that do not
+// exist or cannot be decoded are replaced by a new, empty session.
+func (s *SessionStore) load() {
+	if s.data != nil {
+		return
+	}
+	s.data = make(map[string]interface{})
+	if s.key == "" {
+		return
+	}
+	session, err := Sessions.Get(s.key)
+	if err != nil {
+		if err != SessionDoesNotExist {
+			s.err = err
+		}
+		s.key = ""
+		return
+	}
+	store, err := session.Store()
+	if err != nil {
+		s.key = ""
+		return
+	}
+	s.data = store.data
+	s.expires = session.Expires
+}
+
+// The key of the session, which is empty until a new session is saved
+func (s *SessionStore) Key() string {
+	s.load()
+	return s.key
+}
+
+// The expiration of the session as of its last load or save
+func (s *SessionStore) Expires() time.Time {
+	return s.expires
+}
+
+// Is the session new and without data? The data will not be loaded.
+func (s *SessionStore) IsEmpty() bool {
+	return s.key == "" && len(s.data) == 0
+}
+
+// Save the session data with the salt and secret from the config, creating
+// a new key if needed. The expiration is reset to the session cookie age.
+// Signed cookie sessions are not stored and instead get a new key, which is
+// the signed session data.
+func (s *SessionStore) Save() error {
+	s.load()
+	if s.err != nil {
+		return s.err
+	}
+	data, err := signing.MarshalJSON(s.data)
+	if err != nil {
+		return err
+	}
+	if config.SessionEngine == SignedCookieSessions {
+		session, err := signCookieSession(data)
+		if err != nil {
+			return err
+		}
+		s.key = session.Key
+		s.expires = session.Expires
+		s.Modified = false
+		return nil
+	}
+	encoded, err := encodeSession(data)
+	if err != nil {
+		return err
+	}
+	if s.key == "" {
+		if s.key, err = Sessions.CreateKey(); err != nil {
+			return err
+		}
+	}
+	expires := time.Now().Add(config.SessionCookieAge)
+	if err = Sessions.Save(s.key, encoded, expires); err != nil {
+		return err
+	}
+	s.expires = expires
+	s.Modified = false
+	return nil
+}
+
+// Get the value of the given key and whether it exists
+func (s *SessionStore) Get(key string) (interface{}, bool) {
+	s.load()
+	s.Accessed = true
+	value, ok := s.data[key]
+	return value, ok
+}
+
+// Get the string value of the given key. The boolean is false if the key
+// does not exist or is not a string.
+func (s *SessionStore) GetString(key string) (string, bool) {
+	value, ok := s.Get(key)
+	if !ok {
+		return "", false
+	}
+	str, ok := value.(string)
+	return str, ok
+}
+
+// Does the session have the given key?
+func (s *SessionStore) Has(key string) bool {
+	_, ok := s.Get(key)
+	return ok
+}
+
+// Set the value of the given key. The value must be JSON encodable.
+func (s *SessionStore) Set(key string, value interface{}) {
+	s.load()
+	s.Accessed = true
+	s.Modified = true
+	s.data[key] = value
+}
+
+// Delete the given key
+func (s *SessionStore) Delete(key string) {
+	s.load()
+	s.Accessed = true
+	s.Modified = true
+	delete(s.data, key)
+}
+
+// Delete the given key and return its value and whether it existed.
+// The session is only modified if the key existed.
+func (s *SessionStore) Pop(key string) (interface{}, bool) {
+	s.load()
+	s.Accessed = true
+	value, ok := s.data[key]
+	if ok {
+		s.Modified = true
+		delete(s.data, key)
+	}
+	return value, ok
+}
+
+// Get the sorted keys of the session
+func (s *SessionStore) Keys() []string {
+	s.load()
+	s.Accessed = true
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *SessionStore) Len() int {
+	s.load()
+	s.Accessed = true
+	return len(s.data)
+}
+
+// Delete every key
+func (s *SessionStore) Clear() {
+	s.load()
+	s.Accessed = true
+	s.Modified = true
+	s.data = make(map[string]interface{})
+}
+
+// Move the session data to a new key and delete the session of the old
+// key, like Django's cycle_key. Cycle the key whenever the privileges of
+// the session change, such as on login, to prevent session fixation.
+func (s *SessionStore) CycleKey() error {
+	s.load()
+	if s.err != nil {
+		return s.err
+	}
+	key := s.key
+	s.key = ""
+	if err := s.Save(); err != nil {
+		s.key = key
+		return err
+	}
+	if key == "" {
+		return nil
+	}
+	return Sessions.DeleteKey(key)
+}
+
+// Delete the session data and the session, like Django's flush. The store
+// becomes a new, empty session, whose cookie SessionMiddleware will delete.
+func (s *SessionStore) Flush() error {
+	s.load()
+	if s.err != nil {
+		return s.err
+	}
+	key := s.key
+	s.key = ""
+	s.data = make(map[string]interface{})
+	s.Accessed = true
+	s.Modified = true
+	if key == "" {
+		return nil
+	}
+	return Sessions.DeleteKey(key)
+}
+
+// Encode the session data in the legacy "hmac:json" base64 format
+func (s *SessionStore) Encode(salt, secret []byte) ([]byte, error) {
+	s.load()
+	data, err := signing.MarshalJSON(s.data)
+	if err != nil {
+		return nil, err
+	}
+	return encodeSessionBytes(salt, secret, data), nil
+}
+
+// Decode session data in the legacy "hmac:json" base64 format
+func DecodeSessionStore(salt, secret []byte, encoded string) (*SessionStore, error) {
+	data, err := decodeSessionBytesWithFallbacks(salt, secret, encoded)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalSessionStore(data)
+}
+
+func unmarshalSessionStore(data []byte) (*SessionStore, error) {
+	s := &SessionStore{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&s.data); err != nil || s.data == nil {
+		return nil, BadSessionData
+	}
+	return s, nil
+}
+
+// Decode the session data of either encoding using the config
+func (s *Session) Store() (*SessionStore, error) {
+	data, err := s.decode()
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalSessionStore(data)
+}
@@ -0,0 +1,137 @@
+package djinn
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSessionStore(t *testing.T) {
+	s := NewSessionStore("")
+	if s.Accessed || s.Modified {
+		t.Error("Unexpected accessed or modified new session")
+	}
+
+	if _, ok := s.Get("cart"); ok {
+		t.Error("Unexpected cart in an empty session")
+	}
+	if !s.Accessed || s.Modified {
+		t.Error("Expected a Get to access but not modify the session")
+	}
+
+	s.Set("cart", []interface{}{"apple", "pear"})
+	s.Set("_language", "en")
+	if !s.Modified {
+		t.Error("Expected a Set to modify the session")
+	}
+	keys := s.Keys()
+	if len(keys) != 2 {
+		t.Fatalf("Unexpected length of keys: %d != 2", len(keys))
+	}
+	expectString(t, keys[0], "_language")
+
+	language, ok := s.GetString("_language")
+	if !ok {
+		t.Fatal("Expected a _language key")
+	}
+	expectString(t, language, "en")
+
+	// Popping a missing key does not modify the session
+	s.Modified = false
+	if _, ok = s.Pop("missing"); ok || s.Modified {
+		t.Error("Unexpected modification from popping a missing key")
+	}
+	if _, ok = s.Pop("cart"); !ok || !s.Modified {
+		t.Error("Expected popping an existing key to modify the session")
+	}
+	s.Delete("_language")
+	expectInt(t, s.Len(), 0)
+}
+
+func TestSessionStore_RoundTrip(t *testing.T) {
+	salt := []byte(`django.contrib.sessionsSessionStore`)
+	secret := []byte(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+
+	// Session data written by Django with keys SessionData does not know
+	data := []byte(`{"_auth_user_backend":"django.contrib.auth.backends.ModelBackend","_auth_user_id":1,"cart":{"items":[1,2,3]},"big":12345678901234567890}`)
+	encoded := encodeSessionBytes(salt, secret, data)
+
+	s, err := DecodeSessionStore(salt, secret, string(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt(t, s.Len(), 4)
+	id, _ := s.Get("_auth_user_id")
+	expectString(t, id.(json.Number).String(), "1")
+
+	// Every key and value should survive re-encoding
+	reencoded, err := s.Encode(salt, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeSessionBytes(salt, secret, string(reencoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var before, after interface{}
+	json.Unmarshal(data, &before)
+	json.Unmarshal(decoded, &after)
+	b1, _ := json.Marshal(before)
+	b2, _ := json.Marshal(after)
+	expectString(t, string(b2), string(b1))
+	big, _ := s.Get("big")
+	expectString(t, big.(json.Number).String(), "12345678901234567890")
+
+	// Tampered data should not decode
+	if _, err = DecodeSessionStore(salt, []byte("wrong"), string(encoded)); err != InvalidHMAC {
+		t.Error("Expected an InvalidHMAC error, but one did not occur")
+	}
+
+	// Django decodes session data as latin-1, so it must be ASCII
+	s = NewSessionStore("")
+	s.Set("name", "café")
+	if reencoded, err = s.Encode(salt, secret); err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err = decodeSessionBytes(salt, secret, string(reencoded)); err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, string(decoded), `{"name":"caf\u00e9"}`)
+}
+
+func TestSessionStore_CycleKey(t *testing.T) {
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+	Sessions.Backend = NewMemorySessionBackend()
+	defer func() { Sessions.Backend = nil }()
+
+	s := NewSessionStore("")
+	s.Set("cart", "apple")
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	key := s.Key()
+
+	// The data is moved to a new key and the old session is deleted
+	if err := s.CycleKey(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Key() == key || s.Key() == "" {
+		t.Errorf("Expected a new session key, received %q", s.Key())
+	}
+	if exists, _ := Sessions.Exists(key); exists {
+		t.Error("Expected the session of the old key to be deleted")
+	}
+	cart, _ := NewSessionStore(s.Key()).GetString("cart")
+	expectString(t, cart, "apple")
+
+	// Flushing deletes the data and the session
+	key = s.Key()
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsEmpty() {
+		t.Error("Expected a flushed session to be empty")
+	}
+	if exists, _ := Sessions.Exists(key); exists {
+		t.Error("Expected the flushed session to be deleted")
+	}
+}
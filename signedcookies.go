@@ -0,0 +1,49 @@
+package djinn
+
+import (
+	"encoding/json"
+	"github.com/aodin/djinn/signing"
+	"time"
+)
+
+// The signing salt of django.contrib.sessions.backends.signed_cookies
+const signedCookieSalt = "django.contrib.sessions.backends.signed_cookies"
+
+func signedCookieSigner() *signing.TimestampSigner {
+	signer := signing.NewTimestampSigner(config.Secret)
+	signer.FallbackKeys = config.SecretKeyFallbacks
+	signer.Salt = signedCookieSalt
+	return signer
+}
+
+// Create a signed cookie session of the given JSON session data. The key of
+// the session is the value of its cookie.
+func signCookieSession(data []byte) (*Session, error) {
+	value, err := signedCookieSigner().SignObject(json.RawMessage(data), true)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{
+		Key:     value,
+		Data:    value,
+		Expires: time.Now().Add(config.SessionCookieAge),
+		manager: Sessions,
+		decoded: data,
+	}, nil
+}
+
+// Verify the value of a signed session cookie. Like Django, cookies with an
+// invalid signature or older than the session cookie age do not exist.
+// The expiration of the returned session is unknown.
+func unsignCookieSession(value string) (*Session, error) {
+	var data json.RawMessage
+	if err := signedCookieSigner().UnsignObject(value, config.SessionCookieAge, &data); err != nil {
+		return nil, SessionDoesNotExist
+	}
+	return &Session{
+		Key:     value,
+		Data:    value,
+		manager: Sessions,
+		decoded: data,
+	}, nil
+}
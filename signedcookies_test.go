@@ -0,0 +1,82 @@
+package djinn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignedCookieSessions(t *testing.T) {
+	config.PasswordHasher = "md5"
+	SetSecret(`xsy!9deorcwbk!&=u33!ixik-r9c1@sf6tz0jnb*ce9ipe)e&m`)
+	config.SessionEngine = SignedCookieSessions
+	defer func() { config.SessionEngine = DatabaseSessions }()
+
+	// Signed cookie sessions do not need the django_session table
+	db := createSqliteTestSchema(t, sqliteUserSchema)
+	defer db.Close()
+
+	// A session cookie signed by Django in 2023
+	age := config.SessionCookieAge
+	config.SessionCookieAge = 100 * 365 * 24 * time.Hour
+	session, err := Sessions.Get(".eJyrVopPLC3JiC8tTi2Kz0xRslIyVNJBFktKTM5OzQNJpGQl5qXn6yXn55UUZSbpgZToQWWL9XzzU1JznKBqUQzISCzOAOquoBAADS1IBDojWimxoCAnFcgdnHRsLQCHanjg:1r31eq:_Nxby6IOnUA8ioyDoaXQhW3xKtPawVePuyjwblq0tPI")
+	config.SessionCookieAge = age
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := session.SessionData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, data.AuthUserId, 1)
+	store, err := session.Store()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad, _ := store.Get("pad")
+	expectInt(t, len(pad.([]interface{})), 20)
+
+	// The cookie has expired with the default session cookie age
+	if _, err = Sessions.Get(session.Key); err != SessionDoesNotExist {
+		t.Error("Expected a SessionDoesNotExist error, but one did not occur")
+	}
+
+	user, err := Users.CreateUser("client", "", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := sessionRequest(t, user)
+	authenticated, err := Authenticate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectInt64(t, authenticated.Id, user.Id)
+
+	// Tampered cookies are anonymous
+	cookie, _ := req.Cookie(config.SessionCookieName)
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: "x" + cookie.Value})
+	if _, err = Authenticate(req); err != SessionDoesNotExist {
+		t.Error("Expected a SessionDoesNotExist error, but one did not occur")
+	}
+
+	// The session middleware keeps the data in the cookie
+	h := SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := SessionStoreFromContext(r.Context())
+		count, _ := session.GetString("visits")
+		session.Set("visits", count+"x")
+		w.Write([]byte(count + "x"))
+	}))
+	var sessionCookie *http.Cookie
+	for _, expected := range []string{"x", "xx", "xxx"} {
+		req, _ = http.NewRequest("GET", "/", nil)
+		if sessionCookie != nil {
+			req.AddCookie(sessionCookie)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		expectString(t, w.Body.String(), expected)
+		sessionCookie = (&http.Response{Header: w.Header()}).Cookies()[0]
+	}
+}
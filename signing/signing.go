@@ -0,0 +1,393 @@
+/*
+Package signing is a port of django.core.signing. Values signed by either
+Django or this package can be verified by the other.
+
+	signer := signing.NewSigner("secret")
+	signed, err := signer.Sign("hello") // "hello:<signature>"
+	value, err := signer.Unsign(signed)
+
+Dumps and Loads sign JSON encodable values with a timestamp:
+
+	token, err := signing.Dumps(map[string]int{"id": 1}, "secret", "", false)
+	var data map[string]int
+	err = signing.Loads(token, "secret", "", time.Hour, &data)
+*/
+package signing
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	BadSignature     = errors.New("signing: the signature is invalid")
+	SignatureExpired = errors.New("signing: the signature has expired")
+	UnsafeSeparator  = errors.New("signing: the separator may not be only base64 or base62 characters")
+	UnknownAlgorithm = errors.New("signing: the algorithm is unknown")
+)
+
+// The hash algorithms that may be used to sign, by their Python hashlib name
+var Algorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// The default salt of Dumps and Loads
+const DefaultSalt = "django.core.signing"
+
+// Allow the current time to be set during testing
+var now = time.Now
+
+const base62Alphabet = `0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz`
+
+func b62Encode(n int64) string {
+	if n == 0 {
+		return "0"
+	}
+	var sign string
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	var encoded []byte
+	for n > 0 {
+		encoded = append([]byte{base62Alphabet[n%62]}, encoded...)
+		n /= 62
+	}
+	return sign + string(encoded)
+}
+
+func b62Decode(s string) (int64, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	var sign int64 = 1
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	}
+	if s == "" {
+		return 0, BadSignature
+	}
+	var n int64
+	for _, c := range []byte(s) {
+		i := strings.IndexByte(base62Alphabet, c)
+		if i == -1 {
+			return 0, BadSignature
+		}
+		n = n*62 + int64(i)
+	}
+	return sign * n, nil
+}
+
+// URL safe base64 without padding
+func b64Encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func b64Decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// Django's salted_hmac: an HMAC keyed by the digest of the salt and secret
+func saltedHMAC(digest func() hash.Hash, salt, value, secret string) []byte {
+	h := digest()
+	h.Write([]byte(salt))
+	h.Write([]byte(secret))
+	mac := hmac.New(digest, h.Sum(nil))
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// Separators made only of the characters of base64 or base62 would be
+// ambiguous, like Django's _SEP_UNSAFE
+func unsafeSep(sep string) bool {
+	for _, c := range sep {
+		if !(c >= 'A' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '=') {
+			return false
+		}
+	}
+	return true
+}
+
+// A Signer signs and verifies string values like django.core.signing.Signer.
+// Signatures are made with the Key and verified with either the Key or one
+// of the FallbackKeys, which allows the key to be rotated. Salt namespaces
+// the signatures of different uses of the same key. Sep separates the value
+// and signature and Algorithm is the name of a hash in Algorithms.
+type Signer struct {
+	Key          string
+	FallbackKeys []string
+	Salt         string
+	Sep          string
+	Algorithm    string
+}
+
+// Create a Signer with Django's defaults: the "django.core.signing.Signer"
+// salt, ":" separator and sha256 algorithm
+func NewSigner(key string) *Signer {
+	return &Signer{
+		Key:       key,
+		Salt:      "django.core.signing.Signer",
+		Sep:       ":",
+		Algorithm: "sha256",
+	}
+}
+
+// Get the hash of the signer's algorithm. An unknown algorithm or unsafe
+// separator returns an error.
+func (s *Signer) digest() (func() hash.Hash, error) {
+	if unsafeSep(s.Sep) {
+		return nil, UnsafeSeparator
+	}
+	digest, ok := Algorithms[s.Algorithm]
+	if !ok {
+		return nil, UnknownAlgorithm
+	}
+	return digest, nil
+}
+
+// The base64 signature of the given value
+func (s *Signer) Signature(value string) (string, error) {
+	digest, err := s.digest()
+	if err != nil {
+		return "", err
+	}
+	return signature(digest, s.Salt, value, s.Key), nil
+}
+
+func signature(digest func() hash.Hash, salt, value, key string) string {
+	return b64Encode(saltedHMAC(digest, salt+"signer", value, key))
+}
+
+// Append the separator and signature to the given value
+func (s *Signer) Sign(value string) (string, error) {
+	sig, err := s.Signature(value)
+	if err != nil {
+		return "", err
+	}
+	return value + s.Sep + sig, nil
+}
+
+// Verify the signature of the given signed value with the key or any of
+// the fallback keys and return the value
+func (s *Signer) Unsign(signed string) (string, error) {
+	digest, err := s.digest()
+	if err != nil {
+		return "", err
+	}
+	i := strings.LastIndex(signed, s.Sep)
+	if i == -1 {
+		return "", BadSignature
+	}
+	value, sig := signed[:i], signed[i+len(s.Sep):]
+	for _, key := range append([]string{s.Key}, s.FallbackKeys...) {
+		if hmac.Equal([]byte(sig), []byte(signature(digest, s.Salt, value, key))) {
+			return value, nil
+		}
+	}
+	return "", BadSignature
+}
+
+// Sign the JSON encoding of the given object, compressing it with zlib if
+// that makes it shorter and compress is true
+func (s *Signer) SignObject(obj interface{}, compress bool) (string, error) {
+	value, err := encodeObject(obj, compress)
+	if err != nil {
+		return "", err
+	}
+	return s.Sign(value)
+}
+
+// Verify the signed object and decode its JSON into dest
+func (s *Signer) UnsignObject(signed string, dest interface{}) error {
+	value, err := s.Unsign(signed)
+	if err != nil {
+		return err
+	}
+	return decodeObject(value, dest)
+}
+
+// A TimestampSigner appends a timestamp to the value before signing, so the
+// age of the signature can be checked, like Django's TimestampSigner
+type TimestampSigner struct {
+	Signer
+}
+
+// Create a TimestampSigner with Django's defaults: the
+// "django.core.signing.TimestampSigner" salt, ":" separator and sha256
+// algorithm
+func NewTimestampSigner(key string) *TimestampSigner {
+	s := &TimestampSigner{*NewSigner(key)}
+	s.Salt = "django.core.signing.TimestampSigner"
+	return s
+}
+
+// The current time in base62 seconds
+func (s *TimestampSigner) Timestamp() string {
+	return b62Encode(now().Unix())
+}
+
+// Append the timestamp, then sign
+func (s *TimestampSigner) Sign(value string) (string, error) {
+	return s.Signer.Sign(value + s.Sep + s.Timestamp())
+}
+
+// Verify the signature of the given signed value and return the value.
+// If maxAge is positive, signatures older than maxAge return a
+// SignatureExpired error.
+func (s *TimestampSigner) Unsign(signed string, maxAge time.Duration) (string, error) {
+	result, err := s.Signer.Unsign(signed)
+	if err != nil {
+		return "", err
+	}
+	i := strings.LastIndex(result, s.Sep)
+	if i == -1 {
+		return "", BadSignature
+	}
+	value := result[:i]
+	timestamp, err := b62Decode(result[i+len(s.Sep):])
+	if err != nil {
+		return "", err
+	}
+	if maxAge > 0 && now().Sub(time.Unix(timestamp, 0)) > maxAge {
+		return "", SignatureExpired
+	}
+	return value, nil
+}
+
+// Sign the JSON encoding of the given object with a timestamp
+func (s *TimestampSigner) SignObject(obj interface{}, compress bool) (string, error) {
+	value, err := encodeObject(obj, compress)
+	if err != nil {
+		return "", err
+	}
+	return s.Sign(value)
+}
+
+// Verify the signed object, check its age against maxAge if positive, and
+// decode its JSON into dest
+func (s *TimestampSigner) UnsignObject(signed string, maxAge time.Duration, dest interface{}) error {
+	value, err := s.Unsign(signed, maxAge)
+	if err != nil {
+		return err
+	}
+	return decodeObject(value, dest)
+}
+
+// Encode the object as JSON like Django's JSONSerializer, which uses
+// Python's json.dumps with compact separators and encodes the result as
+// latin-1. Characters outside of ASCII are escaped as \uXXXX, using
+// surrogate pairs above the BMP, and HTML characters are not escaped.
+func MarshalJSON(obj interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(obj); err != nil {
+		return nil, err
+	}
+	data := bytes.TrimSuffix(buf.Bytes(), []byte{'\n'})
+
+	// Non-ASCII bytes of valid JSON can only be within strings
+	escaped := make([]byte, 0, len(data))
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		switch {
+		case r < utf8.RuneSelf:
+			escaped = append(escaped, byte(r))
+		case r > 0xFFFF:
+			r1, r2 := utf16.EncodeRune(r)
+			escaped = append(escaped, fmt.Sprintf(`\u%04x\u%04x`, r1, r2)...)
+		default:
+			escaped = append(escaped, fmt.Sprintf(`\u%04x`, r)...)
+		}
+	}
+	return escaped, nil
+}
+
+// Encode the object as base64 JSON. Compressed data is prefixed with "."
+func encodeObject(obj interface{}, compress bool) (string, error) {
+	data, err := MarshalJSON(obj)
+	if err != nil {
+		return "", err
+	}
+	var compressed bool
+	if compress {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(data)
+		w.Close()
+		if buf.Len() < len(data)-1 {
+			data = buf.Bytes()
+			compressed = true
+		}
+	}
+	value := b64Encode(data)
+	if compressed {
+		value = "." + value
+	}
+	return value, nil
+}
+
+// Decode the JSON of a value built by encodeObject into dest
+func decodeObject(value string, dest interface{}) error {
+	compressed := strings.HasPrefix(value, ".")
+	data, err := b64Decode(strings.TrimPrefix(value, "."))
+	if err != nil {
+		return BadSignature
+	}
+	if compressed {
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return BadSignature
+		}
+		defer r.Close()
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return BadSignature
+		}
+	}
+	return json.Unmarshal(data, dest)
+}
+
+// Sign the JSON encoding of the given object with a TimestampSigner, like
+// django.core.signing.dumps. An empty salt uses DefaultSalt.
+func Dumps(obj interface{}, key, salt string, compress bool) (string, error) {
+	if salt == "" {
+		salt = DefaultSalt
+	}
+	s := NewTimestampSigner(key)
+	s.Salt = salt
+	return s.SignObject(obj, compress)
+}
+
+// Verify a value signed by Dumps and decode its JSON into dest, like
+// django.core.signing.loads. An empty salt uses DefaultSalt. If maxAge is
+// positive, older signatures return a SignatureExpired error. Signatures
+// made with any of the fallback keys are also accepted.
+func Loads(signed, key, salt string, maxAge time.Duration, dest interface{}, fallbackKeys ...string) error {
+	if salt == "" {
+		salt = DefaultSalt
+	}
+	s := NewTimestampSigner(key)
+	s.FallbackKeys = fallbackKeys
+	s.Salt = salt
+	return s.UnsignObject(signed, maxAge, dest)
+}
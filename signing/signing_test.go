@@ -0,0 +1,231 @@
+package signing
+
+import (
+	"testing"
+	"time"
+)
+
+func expectString(t *testing.T, a, b string) {
+	if a != b {
+		t.Errorf("Unexpected string: %s != %s", a, b)
+	}
+}
+
+// Sign the value with a signer that must be valid
+func sign(t *testing.T, signer interface {
+	Sign(string) (string, error)
+}, value string) string {
+	signed, err := signer.Sign(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// Fix the current time at 1700000000, which is "1r31eq" in base62
+func fixNow(seconds int64) func() {
+	now = func() time.Time { return time.Unix(seconds, 0) }
+	return func() { now = time.Now }
+}
+
+func TestB62(t *testing.T) {
+	for _, n := range []int64{0, 1, 61, 62, 1700000000, -1700000000} {
+		decoded, err := b62Decode(b62Encode(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != n {
+			t.Errorf("Unexpected base62 round trip: %d != %d", decoded, n)
+		}
+	}
+	expectString(t, b62Encode(1700000000), "1r31eq")
+	if _, err := b62Decode("a!"); err != BadSignature {
+		t.Error("Expected a BadSignature error, but one did not occur")
+	}
+}
+
+func TestSigner(t *testing.T) {
+	// Signatures calculated by django.core.signing
+	signer := NewSigner("predictable-secret")
+	expectString(t, sign(t, signer, "hello"), "hello:T8oWtiMIRTzcoR3NRO-2PQNf5dTweZy0EL25Kt6lUo0")
+
+	value, err := signer.Unsign("hello:T8oWtiMIRTzcoR3NRO-2PQNf5dTweZy0EL25Kt6lUo0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, value, "hello")
+
+	for _, bad := range []string{"hello", "hello:", "hellO:T8oWtiMIRTzcoR3NRO-2PQNf5dTweZy0EL25Kt6lUo0"} {
+		if _, err = signer.Unsign(bad); err != BadSignature {
+			t.Errorf("Expected a BadSignature error for %q, but one did not occur", bad)
+		}
+	}
+
+	signer.Algorithm = "sha1"
+	expectString(t, sign(t, signer, "hello"), "hello:-e76rxAuvXG_P3pKzQ26zIqf5fY")
+
+	signer = NewSigner("predictable-secret")
+	signer.Salt = "extra-salt"
+	signer.Sep = "~"
+	expectString(t, sign(t, signer, "hello"), "hello~g8YZrsJ1xXg4hGFgU2uc4ff9ZZRKt3ReprMkjND8TfM")
+
+	// Values may contain the separator
+	signed := sign(t, signer, "a~b~c")
+	value, err = signer.Unsign(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, value, "a~b~c")
+}
+
+func TestSigner_FallbackKeys(t *testing.T) {
+	old := NewSigner("old-secret")
+	signed := sign(t, old, "hello")
+
+	signer := NewSigner("new-secret")
+	if _, err := signer.Unsign(signed); err != BadSignature {
+		t.Error("Expected a BadSignature error, but one did not occur")
+	}
+
+	// Values signed with a fallback key are verified, but the current key
+	// is always used to sign
+	signer.FallbackKeys = []string{"other-secret", "old-secret"}
+	value, err := signer.Unsign(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, value, "hello")
+	if sign(t, signer, "hello") == signed {
+		t.Error("Expected the value to be signed with the current key")
+	}
+
+	var data map[string]string
+	dumped, err := Dumps(map[string]string{"a": "b"}, "old-secret", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Loads(dumped, "new-secret", "", 0, &data); err != BadSignature {
+		t.Error("Expected a BadSignature error, but one did not occur")
+	}
+	if err = Loads(dumped, "new-secret", "", 0, &data, "old-secret"); err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, data["a"], "b")
+}
+
+func TestSigner_Unsafe(t *testing.T) {
+	signer := NewSigner("predictable-secret")
+	signed := sign(t, signer, "hello")
+	for _, sep := range []string{"", "-", "a", "=="} {
+		signer.Sep = sep
+		if _, err := signer.Sign("hello"); err != UnsafeSeparator {
+			t.Errorf("Expected an UnsafeSeparator error for the separator %q, but one did not occur", sep)
+		}
+		if _, err := signer.Unsign(signed); err != UnsafeSeparator {
+			t.Errorf("Expected an UnsafeSeparator error for the separator %q, but one did not occur", sep)
+		}
+	}
+
+	signer = NewSigner("predictable-secret")
+	signer.Algorithm = "sha3"
+	if _, err := signer.Sign("hello"); err != UnknownAlgorithm {
+		t.Error("Expected an UnknownAlgorithm error, but one did not occur")
+	}
+	if _, err := signer.Unsign(signed); err != UnknownAlgorithm {
+		t.Error("Expected an UnknownAlgorithm error, but one did not occur")
+	}
+	if _, err := Dumps("hello", "predictable-secret", "", false); err != nil {
+		t.Errorf("Unexpected error from a valid signer: %s", err)
+	}
+}
+
+func TestTimestampSigner(t *testing.T) {
+	defer fixNow(1700000000)()
+
+	signer := NewTimestampSigner("predictable-secret")
+	signed := sign(t, signer, "hello")
+	expectString(t, signed, "hello:1r31eq:ESnvh0UG3MKjmlEh8oOo4AB3aBbzEzE2OxtKdYRmPIU")
+
+	value, err := signer.Unsign(signed, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, value, "hello")
+
+	// The signature expires after the max age
+	fixNow(1700000000 + 61)
+	if _, err = signer.Unsign(signed, time.Minute); err != SignatureExpired {
+		t.Error("Expected a SignatureExpired error, but one did not occur")
+	}
+	if _, err = signer.Unsign(signed, 0); err != nil {
+		t.Errorf("Unexpected error without a max age: %s", err)
+	}
+}
+
+func TestDumpsLoads(t *testing.T) {
+	defer fixNow(1700000000)()
+
+	signed, err := Dumps(map[string]string{"a": "b"}, "predictable-secret", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, signed, "eyJhIjoiYiJ9:1r31eq:uA2pBR7qu96deKD7b1iJHQ2d2CSdTQXcx-zWXJZb8WA")
+
+	var data map[string]string
+	if err = Loads(signed, "predictable-secret", "", time.Hour, &data); err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, data["a"], "b")
+
+	if err = Loads(signed, "predictable-secret", "other", 0, &data); err != BadSignature {
+		t.Error("Expected a BadSignature error, but one did not occur")
+	}
+
+	// Compressed data is prefixed with a period
+	list := make([]string, 30)
+	for i := range list {
+		list[i] = "repeat"
+	}
+	signed, err = Dumps(list, "predictable-secret", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed[0] != '.' {
+		t.Errorf("Expected compressed data, received %s", signed)
+	}
+	var decoded []string
+	if err = Loads(signed, "predictable-secret", "", 0, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(list) {
+		t.Errorf("Unexpected length of loaded list: %d != %d", len(decoded), len(list))
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	data, err := MarshalJSON(map[string]string{"name": "café ☕ 😀", "html": "<&>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, string(data), `{"html":"<&>","name":"caf\u00e9 \u2615 \ud83d\ude00"}`)
+}
+
+func TestDumpsLoads_NonASCII(t *testing.T) {
+	defer fixNow(1700000000)()
+
+	// Minted by the django.core.signing algorithm, whose JSONSerializer
+	// requires ASCII JSON since it encodes the JSON as latin-1
+	token := "eyJuYW1lIjoiY2FmXHUwMGU5IFx1MjYxNSBcdWQ4M2RcdWRlMDAifQ:1r31eq:r-YnwqNlF3Qnmzg7ej-HQONO9GcKwK2luZmQ6sfe-MU"
+
+	var data map[string]string
+	if err := Loads(token, "predictable-secret", "", 0, &data); err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, data["name"], "café ☕ 😀")
+
+	signed, err := Dumps(data, "predictable-secret", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectString(t, signed, token)
+}
@@ -37,6 +37,40 @@ func (d *DB) Exec(q string, args ...interface{}) (sql.Result, error) {
 	return result, err
 }
 
+// The queries of either a DB or a transaction
+type querier interface {
+	Query(q string, args ...interface{}) (*sql.Rows, error)
+	Exec(q string, args ...interface{}) (sql.Result, error)
+}
+
+// Wrap the sql.Tx to log its queries like DB
+type transaction struct {
+	*sql.Tx
+	db *DB
+}
+
+func (d *DB) begin() (*transaction, error) {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &transaction{Tx: tx, db: d}, nil
+}
+
+func (t *transaction) Query(q string, args ...interface{}) (rows *sql.Rows, err error) {
+	before := time.Now()
+	rows, err = t.Tx.Query(q, args...)
+	t.db.Log(q, time.Now().Sub(before), args)
+	return
+}
+
+func (t *transaction) Exec(q string, args ...interface{}) (sql.Result, error) {
+	before := time.Now()
+	result, err := t.Tx.Exec(q, args...)
+	t.db.Log(q, time.Now().Sub(before), args)
+	return result, err
+}
+
 // Output the elapsed time, query, and arguments
 func (d *DB) Log(q string, elapsed time.Duration, args ...interface{}) {
 	// TODO Only output if a logger exists
@@ -55,7 +89,7 @@ func (d *DB) JoinColumns(columns []string) string {
 func (d *DB) JoinColumnParametersWith(columns []string, sep string, start int) string {
 	escaped := make([]string, len(columns))
 	for i, column := range columns {
-		escaped[i] = fmt.Sprintf(`"%s" = %s`, column, d.dialect.Parameter(i+i))
+		escaped[i] = fmt.Sprintf(`"%s" = %s`, column, d.dialect.Parameter(start+i))
 	}
 	return strings.Join(escaped, sep)
 }
@@ -78,6 +112,27 @@ type Dialect interface {
 	InsertReturningId(m *Manager, columns []string, params ...interface{}) (int64, error)
 }
 
+// A Dialect whose LIMIT and OFFSET clause differs from the standard
+type limiter interface {
+	Limit(limit, offset int) string
+}
+
+// The LIMIT and OFFSET clause of the dialect, which is the standard clause
+// unless the dialect is a limiter. A negative limit will not limit the
+// number of rows.
+func (d *DB) Limit(limit, offset int) (clause string) {
+	if l, ok := d.dialect.(limiter); ok {
+		return l.Limit(limit, offset)
+	}
+	if limit >= 0 {
+		clause += fmt.Sprintf(` LIMIT %d`, limit)
+	}
+	if offset > 0 {
+		clause += fmt.Sprintf(` OFFSET %d`, offset)
+	}
+	return
+}
+
 // TODO A base dialect?
 
 type PostGres struct{}
@@ -118,6 +173,17 @@ func (d *Sqlite3) InsertReturningId(m *Manager, columns []string, params ...inte
 	return result.LastInsertId()
 }
 
+// SQLite requires a LIMIT for any OFFSET, where a negative limit is unbounded
+func (d *Sqlite3) Limit(limit, offset int) string {
+	if offset > 0 {
+		return fmt.Sprintf(` LIMIT %d OFFSET %d`, limit, offset)
+	}
+	if limit >= 0 {
+		return fmt.Sprintf(` LIMIT %d`, limit)
+	}
+	return ""
+}
+
 // The single dialect instance that all managers will embed
 // TODO What about multiple databases?
 var connection DB
@@ -21,3 +21,15 @@ func createSqliteTestSchema(t *testing.T, schemas ...string) *DB {
 	}
 	return db
 }
+
+func TestDB_Limit(t *testing.T) {
+	// Dialects without a Limit method use the standard clause
+	db := &DB{dialect: &PostGres{}}
+	expectString(t, db.Limit(-1, 0), "")
+	expectString(t, db.Limit(2, 0), " LIMIT 2")
+	expectString(t, db.Limit(-1, 3), " OFFSET 3")
+	expectString(t, db.Limit(2, 3), " LIMIT 2 OFFSET 3")
+
+	db = &DB{dialect: &Sqlite3{}}
+	expectString(t, db.Limit(-1, 3), " LIMIT -1 OFFSET 3")
+}
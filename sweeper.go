@@ -0,0 +1,67 @@
+package djinn
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var InvalidSweepInterval = errors.New("djinn: the session sweep interval must be positive")
+
+// Create the ticks of a sweeper and a function to stop them. Allow the ticks
+// to be sent by hand during testing.
+var newSweepTicker = func(interval time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
+
+// A SessionSweeper clears expired sessions in the background, replacing a
+// cron job of Django's clearsessions command
+type SessionSweeper struct {
+	manager  *SessionManager
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// Clear the expired sessions of the manager every interval until the
+// returned sweeper is stopped. Errors are logged and the sweeper continues.
+// The interval must be positive.
+func (m *SessionManager) StartSweeper(interval time.Duration) (*SessionSweeper, error) {
+	if interval <= 0 {
+		return nil, InvalidSweepInterval
+	}
+	s := &SessionSweeper{
+		manager:  m,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *SessionSweeper) run() {
+	defer close(s.done)
+	ticks, stop := newSweepTicker(s.interval)
+	defer stop()
+	for {
+		select {
+		case <-ticks:
+			if err := s.manager.ClearExpired(); err != nil {
+				log.Println("djinn: could not clear expired sessions:", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Stop the sweeper, waiting for a sweep in progress to finish. It is safe
+// to call Stop more than once.
+func (s *SessionSweeper) Stop() {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+}
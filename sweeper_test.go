@@ -0,0 +1,70 @@
+package djinn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionManager_ClearExpired(t *testing.T) {
+	db := createSqliteTestSchema(t, sqliteSessionSchema)
+	defer db.Close()
+
+	if err := Sessions.Save("expired", "data", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Sessions.Save("active", "data", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Sessions.ClearExpired(); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := Sessions.Exists("expired"); exists {
+		t.Error("Expected the expired session to be cleared")
+	}
+	if exists, _ := Sessions.Exists("active"); !exists {
+		t.Error("Expected the active session to remain")
+	}
+}
+
+func TestSessionSweeper(t *testing.T) {
+	backend := NewMemorySessionBackend()
+	manager := &SessionManager{Backend: backend}
+	if err := manager.Save("expired", "data", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Non-positive intervals are rejected before a sweeper is started
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := manager.StartSweeper(interval); err != InvalidSweepInterval {
+			t.Errorf("Expected an InvalidSweepInterval error for %s, but one did not occur", interval)
+		}
+	}
+
+	// Send the ticks by hand
+	ticks := make(chan time.Time)
+	original := newSweepTicker
+	newSweepTicker = func(time.Duration) (<-chan time.Time, func()) {
+		return ticks, func() {}
+	}
+	defer func() { newSweepTicker = original }()
+
+	sweeper, err := manager.StartSweeper(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stop waits for the sweep of the received tick to finish
+	ticks <- time.Now()
+	sweeper.Stop()
+	sweeper.Stop()
+	if exists, _ := backend.Exists("expired"); exists {
+		t.Error("Expected the sweeper to clear the expired session")
+	}
+
+	// No ticks are received after the sweeper is stopped
+	select {
+	case ticks <- time.Now():
+		t.Error("Unexpected sweep after the sweeper was stopped")
+	default:
+	}
+}
@@ -1,9 +1,8 @@
 package djinn
 
 import (
+	"crypto/sha256"
 	"errors"
-	"fmt"
-	"reflect"
 	"strings"
 	"time"
 )
@@ -28,49 +27,136 @@ type User struct {
 	DateJoined  time.Time `db:"date_joined"`
 	LastLogin   time.Time `db:"last_login"`
 	manager     *UserManager
+	permCache   map[string]bool
 }
 
 func (u *User) String() string {
 	return u.Username
 }
 
-// TODO Save and delete should be proxies to a manager method
 // Delete the user from the database
 func (u *User) Delete() error {
-	// TODO There must be a non-nil manager and database connection
-	query := fmt.Sprintf(
-		`DELETE FROM "%s" WHERE "%s" = %s`,
-		u.manager.table,
-		u.manager.primary,
-		u.manager.db.dialect.Parameter(0),
-	)
-	_, err := u.manager.db.Exec(query, u.Id)
-	return err
+	return u.manager.Delete(u)
 }
 
 // Update the user
 func (u *User) Save() error {
-	// TODO There must be a non-nil manager and database connection
-	// TODO Only update the properties that changed?
-	columns := Users.columns[1:]
-	query := fmt.Sprintf(
-		`UPDATE "%s" SET %s WHERE "%s" = %s`,
-		u.manager.table,
-		u.manager.db.JoinColumnParameters(columns),
-		u.manager.primary,
-		u.manager.db.dialect.Parameter(len(columns)),
-	)
-
-	// Build the list of parameters
-	elem := reflect.ValueOf(u).Elem()
-	parameters := make([]interface{}, len(columns)+1)
-	for i := 1; i < elem.NumField(); i++ {
-		parameters[i-1] = elem.Field(i).Addr().Interface()
+	return u.manager.Save(u)
+}
+
+// Users are always authenticated, see AnonymousUser
+func (u *User) IsAuthenticated() bool {
+	return true
+}
+
+func (u *User) IsAnonymous() bool {
+	return false
+}
+
+// auth_user_groups
+var userGroups = &manyToMany{
+	db:    &connection,
+	table: "auth_user_groups",
+	from:  "user_id",
+	to:    "group_id",
+}
+
+func groupIds(groups []*Group) []int64 {
+	ids := make([]int64, len(groups))
+	for i, group := range groups {
+		if group != nil {
+			ids[i] = group.Id
+		}
 	}
-	parameters[len(columns)] = u.Id
+	return ids
+}
+
+// Get the groups of the user ordered by id
+func (u *User) Groups() (groups []*Group, err error) {
+	err = userGroups.all(Groups.ModelManager, &groups, u.Id)
+	return
+}
+
+// Add the user to the given groups. Existing memberships are ignored.
+func (u *User) AddGroup(groups ...*Group) error {
+	u.permCache = nil
+	return userGroups.add(u.Id, groupIds(groups)...)
+}
+
+// Remove the user from the given groups
+func (u *User) RemoveGroup(groups ...*Group) error {
+	u.permCache = nil
+	return userGroups.remove(u.Id, groupIds(groups)...)
+}
+
+// Set the groups of the user to exactly the given groups
+func (u *User) SetGroups(groups ...*Group) error {
+	u.permCache = nil
+	return userGroups.set(u.Id, groupIds(groups)...)
+}
+
+// Remove the user from every group
+func (u *User) ClearGroups() error {
+	u.permCache = nil
+	return userGroups.clear(u.Id)
+}
+
+// Get the permissions given directly to the user, excluding those of its
+// groups, ordered by id
+func (u *User) UserPermissions() (permissions []*Permission, err error) {
+	err = userPermissions.all(Permissions.ModelManager, &permissions, u.Id)
+	return
+}
+
+// Give the user the given permissions. Existing permissions are ignored.
+func (u *User) AddPermission(permissions ...*Permission) error {
+	u.permCache = nil
+	return userPermissions.add(u.Id, permissionIds(permissions)...)
+}
+
+// Revoke the given permissions from the user
+func (u *User) RemovePermission(permissions ...*Permission) error {
+	u.permCache = nil
+	return userPermissions.remove(u.Id, permissionIds(permissions)...)
+}
+
+// Set the permissions of the user to exactly the given permissions
+func (u *User) SetPermissions(permissions ...*Permission) error {
+	u.permCache = nil
+	return userPermissions.set(u.Id, permissionIds(permissions)...)
+}
 
-	_, err := u.manager.db.Exec(query, parameters...)
-	return err
+// Revoke every permission given directly to the user
+func (u *User) ClearPermissions() error {
+	u.permCache = nil
+	return userPermissions.clear(u.Id)
+}
+
+const sessionAuthHashSalt = "django.contrib.auth.models.AbstractBaseUser.get_session_auth_hash"
+
+// The salted HMAC of the password hash stored in the session by Django 1.7+.
+// Changing the password invalidates every session of the user.
+// The HMAC algorithm is set by the SessionAuthHashAlgorithm config.
+func (u *User) GetSessionAuthHash() string {
+	if config.SessionAuthHashAlgorithm == "sha256" {
+		return string(saltedHMAC(sha256.New, []byte(sessionAuthHashSalt), []byte(config.Secret), []byte(u.Password)))
+	}
+	return string(SaltedHMAC([]byte(sessionAuthHashSalt), []byte(config.Secret), []byte(u.Password)))
+}
+
+// Does the given session auth hash match the password of the user? Both the
+// sha1 hashes of Django before 3.1 and the sha256 hashes of later versions
+// are accepted, made with either the secret or one of its fallbacks.
+func (u *User) verifySessionAuthHash(authHash string) bool {
+	password := []byte(u.Password)
+	for _, secret := range append([]string{config.Secret}, config.SecretKeyFallbacks...) {
+		sha1Hash := SaltedHMAC([]byte(sessionAuthHashSalt), []byte(secret), password)
+		sha256Hash := saltedHMAC(sha256.New, []byte(sessionAuthHashSalt), []byte(secret), password)
+		if ConstantTimeStringCompare(authHash, string(sha1Hash)) || ConstantTimeStringCompare(authHash, string(sha256Hash)) {
+			return true
+		}
+	}
+	return false
 }
 
 func (u *User) CheckPassword(password string) (bool, error) {
@@ -88,53 +174,22 @@ func (u *User) CheckPassword(password string) (bool, error) {
 }
 
 type UserManager struct {
-	*Manager
+	*ModelManager
 }
 
-// Build columns and primary keys dynamically - on init?
+// The columns and primary key are built from the User struct tags
 var Users = &UserManager{
-	&Manager{
-		db:      &connection,
-		table:   "auth_user",
-		columns: []string{"id", "username", "password", "first_name", "last_name", "email", "is_active", "is_staff", "is_superuser", "date_joined", "last_login"},
-		primary: "id",
-	},
+	newModelManager("auth_user", User{}, UserDoesNotExist, MultipleUsers),
 }
 
-func (m *UserManager) All() (users []*User, err error) {
-	query := fmt.Sprintf(
-		`SELECT %s FROM "%s"`,
-		m.db.JoinColumns(m.columns),
-		m.table,
-	)
-
-	// TODO performance of the interface building versus direct struct scan?
-	rows, err := m.db.Query(query)
-	if err != nil {
-		return
-	}
-	for rows.Next() {
-		user := &User{
-			manager: m,
-		}
-		// Build the parameter interfaces
-		// TODO This can be generalized, and likely better performing
-		elem := reflect.ValueOf(user).Elem()
-		tags := reflect.TypeOf(user).Elem()
-		dest := make([]interface{}, 0)
-		for i := 0; i < elem.NumField(); i++ {
-			if tags.Field(i).Tag.Get("db") != "" {
-				dest = append(dest, elem.Field(i).Addr().Interface())
-			}
-		}
-		if err = rows.Scan(dest...); err != nil {
-			return
-		}
-		users = append(users, user)
-	}
-	if err = rows.Err(); err != nil {
-		return
+func init() {
+	Users.prepare = func(obj interface{}) {
+		obj.(*User).manager = Users
 	}
+}
+
+func (m *UserManager) All() (users []*User, err error) {
+	err = m.ModelManager.All(&users)
 	return
 }
 
@@ -158,31 +213,11 @@ func (m *UserManager) createUser(username, email, password string, is_staff, is_
 		IsActive:    true,
 		DateJoined:  now,
 		LastLogin:   now,
-		manager:     m,
 	}
-
-	// Build a list of parameters
-	// TODO We want the columns except for the id, we know it's first for now
-	columns := m.columns[1:]
-
-	// Build the parameter interfaces
-	elem := reflect.ValueOf(user).Elem()
-	tags := reflect.TypeOf(user).Elem()
-	params := make([]interface{}, 0)
-	// Start at 1 to skip the id
-	for i := 1; i < elem.NumField(); i++ {
-		if tags.Field(i).Tag.Get("db") != "" {
-			params = append(params, elem.Field(i).Addr().Interface())
-		}
-	}
-
-	// INSERT with an auto-increment id varies between dialects
-	id, err := m.db.dialect.InsertReturningId(m.Manager, columns, params...)
-	if err != nil {
+	if err = m.Create(user); err != nil {
 		return nil, err
 	}
-	user.Id = id
-	return user, err
+	return user, nil
 }
 
 func (m *UserManager) CreateUser(username, email, password string) (*User, error) {
@@ -197,9 +232,6 @@ func (m *UserManager) CreateSuperuser(username, email, password string) (*User,
 	return m.createUser(username, email, password, true, true)
 }
 
-// func (m *UserManager) Filter(values Values) (users []*User, err error) {
-// }
-
 // Users.Get() behavior (disregarding database or attribute errors):
 // * No results:       (nil, UserDoesNotExist)
 // * One result:       (<user>, nil)
@@ -209,58 +241,9 @@ func (m *UserManager) GetId(id int64) (*User, error) {
 }
 
 func (m *UserManager) Get(values Values) (*User, error) {
-	// TODO There must be a database connection and at least one value
-
-	// Build the WHERE statement
-	// These must equal the values given or the function returns an error
-	parameters := make([]interface{}, len(values))
-	valid := make([]string, len(values))
-
-	index := 0
-	for key, value := range values {
-		if !m.isValid(key) {
-			return nil, fmt.Errorf(`djinn: invalid column %q in Users.Get()`, key)
-		}
-		valid[index] = key
-		parameters[index] = value
-		index += 1
-	}
-	query := fmt.Sprintf(
-		`SELECT %s FROM "%s" WHERE %s LIMIT 2`,
-		m.db.JoinColumns(m.columns),
-		m.table,
-		m.db.JoinColumnParametersWith(valid, " AND ", 0),
-	)
-
-	// Destination for queried User
-	user := &User{
-		manager: m,
-	}
-
-	// Build the destination interfaces
-	elem := reflect.ValueOf(user).Elem()
-	tags := reflect.TypeOf(user).Elem()
-	dest := make([]interface{}, 0)
-	for i := 0; i < elem.NumField(); i++ {
-		if tags.Field(i).Tag.Get("db") != "" {
-			dest = append(dest, elem.Field(i).Addr().Interface())
-		}
-	}
-
-	rows, err := m.db.Query(query, parameters...)
-	if err != nil {
-		return nil, err
-	}
-
-	// One, and only one result should be returned
-	if !rows.Next() {
-		return nil, UserDoesNotExist
-	}
-	if err := rows.Scan(dest...); err != nil {
+	user := &User{}
+	if err := m.ModelManager.Get(user, values); err != nil {
 		return nil, err
 	}
-	if rows.Next() {
-		return nil, MultipleUsers
-	}
 	return user, nil
 }
@@ -111,6 +111,6 @@ func TestUsers(t *testing.T) {
 		t.Fatal(err)
 	}
 	if len(users) != 2 {
-		t.Fatalf("Unexpected length of Users.All(): %s != 2", len(users))
+		t.Fatalf("Unexpected length of Users.All(): %d != 2", len(users))
 	}
 }